@@ -0,0 +1,103 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrWeakConfig is returned by New in strict mode when the configuration has known weaknesses
+var ErrWeakConfig = errors.New("qpp: weak configuration")
+
+// ConfigReport describes how a pad count and seed length fare against the known weaknesses of QPP
+type ConfigReport struct {
+	NumPads   int   // Number of pads
+	SeedLen   int   // Length of the seed in bytes
+	Qubits    uint8 // Number of qubits of each pad
+	PadSwitch int   // Pad switch interval
+
+	// Pad counts sharing a factor with the pad switch interval show a hidden
+	// structure in the ciphertext, e.g. χ² is 3818 for 64 pads but 230 for 15 pads.
+	GCD     int  // Greatest common divisor of NumPads and PadSwitch
+	Coprime bool // Whether GCD is 1
+
+	MinimumPads int  // QPPMinimumPads(Qubits), pads needed to hold the full permutation space
+	EnoughPads  bool // Whether NumPads reaches MinimumPads
+
+	MinimumSeedLength int  // QPPMinimumSeedLength(Qubits), seed bytes needed to reach every permutation
+	SeedTooShort      bool // Whether SeedLen is below MinimumSeedLength
+
+	Warnings []string // Human readable description of every weakness found
+}
+
+// AdviseConfig reports the weaknesses of numPads pads derived from a seed of seedLen bytes,
+// for QUBITS qubits and a pad switch interval of PAD_SWITCH.
+func AdviseConfig(numPads, seedLen int) ConfigReport {
+	return adviseConfig(numPads, seedLen, QUBITS, PAD_SWITCH)
+}
+
+// adviseConfig reports the weaknesses for any number of qubits and pad switch interval
+func adviseConfig(numPads, seedLen int, qubits uint8, padSwitch int) ConfigReport {
+	r := ConfigReport{
+		NumPads:           numPads,
+		SeedLen:           seedLen,
+		Qubits:            qubits,
+		PadSwitch:         padSwitch,
+		GCD:               gcd(numPads, padSwitch),
+		MinimumPads:       QPPMinimumPads(qubits),
+		MinimumSeedLength: QPPMinimumSeedLength(qubits),
+	}
+
+	r.Coprime = r.GCD == 1
+	if !r.Coprime {
+		r.Warnings = append(r.Warnings, fmt.Sprintf("%d pads share the factor %d with the pad switch interval %d", numPads, r.GCD, padSwitch))
+	}
+
+	r.EnoughPads = numPads >= r.MinimumPads
+	if !r.EnoughPads {
+		r.Warnings = append(r.Warnings, fmt.Sprintf("%d pads are fewer than the minimum of %d for %d qubits", numPads, r.MinimumPads, qubits))
+	}
+
+	r.SeedTooShort = seedLen < r.MinimumSeedLength
+	if r.SeedTooShort {
+		r.Warnings = append(r.Warnings, fmt.Sprintf("%d-byte seed is shorter than the minimum of %d bytes for %d qubits", seedLen, r.MinimumSeedLength, qubits))
+	}
+
+	return r
+}
+
+// Weak reports whether any weakness was found
+func (r ConfigReport) Weak() bool {
+	return len(r.Warnings) > 0
+}
+
+// Err returns an error wrapping ErrWeakConfig that lists the weaknesses, or nil
+func (r ConfigReport) Err() error {
+	if !r.Weak() {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrWeakConfig, strings.Join(r.Warnings, "; "))
+}
+
+// gcd returns the greatest common divisor of a and b
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
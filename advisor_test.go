@@ -0,0 +1,77 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+import (
+	"crypto/rand"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdviseConfig(t *testing.T) {
+	minSeed := QPPMinimumSeedLength(QUBITS)
+	minPads := QPPMinimumPads(QUBITS)
+
+	good := AdviseConfig(977, minSeed)
+	t.Logf("%+v", good)
+	assert.False(t, good.Weak())
+	assert.Nil(t, good.Err())
+	assert.Equal(t, 1, good.GCD)
+	assert.True(t, good.Coprime)
+	assert.True(t, good.EnoughPads)
+	assert.False(t, good.SeedTooShort)
+
+	weak := AdviseConfig(64, 32)
+	t.Logf("%+v", weak)
+	assert.True(t, weak.Weak())
+	assert.ErrorIs(t, weak.Err(), ErrWeakConfig)
+	assert.Equal(t, 8, weak.GCD)
+	assert.False(t, weak.Coprime)
+	assert.True(t, weak.EnoughPads)
+	assert.True(t, weak.SeedTooShort)
+	assert.Equal(t, 2, len(weak.Warnings))
+
+	few := AdviseConfig(minPads-2, minSeed)
+	assert.False(t, few.EnoughPads)
+	assert.True(t, few.Coprime)
+	assert.Equal(t, 1, len(few.Warnings))
+}
+
+func TestStrictMode(t *testing.T) {
+	seed := make([]byte, QPPMinimumSeedLength(QUBITS))
+	io.ReadFull(rand.Reader, seed)
+
+	_, err := New(seed, &Options{NumPads: 64, Strict: true})
+	assert.ErrorIs(t, err, ErrWeakConfig)
+	_, err = New(seed[:32], &Options{NumPads: 977, Strict: true})
+	assert.ErrorIs(t, err, ErrWeakConfig)
+	_, err = New(seed, &Options{NumPads: 3, Strict: true})
+	assert.ErrorIs(t, err, ErrWeakConfig)
+
+	// the gcd is taken with the instance's pad switch interval
+	_, err = New(seed, &Options{NumPads: 15, PadSwitch: 5, Strict: true})
+	assert.ErrorIs(t, err, ErrWeakConfig)
+
+	qpp, err := New(seed, &Options{NumPads: 977, Strict: true})
+	assert.Nil(t, err)
+	assert.NotNil(t, qpp)
+
+	// weak configurations are still accepted without strict mode
+	_, err = New(seed[:32], &Options{NumPads: 64})
+	assert.Nil(t, err)
+}
@@ -0,0 +1,267 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+import (
+	"container/list"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"sync"
+)
+
+// Pad set cache parameters
+const (
+	DEFAULT_CACHE_SIZE     = 16                                   // number of pad sets kept by DefaultPadSetCache
+	HASH_FINGERPRINT_INPUT = "___QUANTUM_PERMUTATION_PAD_HASH___" // message whose digest identifies a KDF hash function
+)
+
+// KDFFingerprinter is implemented by custom KDFs that PadSetCache may cache
+// Fingerprint must return different bytes for KDFs that derive different keys,
+// PadSetCache derives pad sets of other custom KDFs without caching them.
+type KDFFingerprinter interface {
+	KDF
+	Fingerprint() []byte
+}
+
+// DefaultPadSetCache is a process-wide cache, enable it with Options.Cache = DefaultPadSetCache
+var DefaultPadSetCache = NewPadSetCache(DEFAULT_CACHE_SIZE)
+
+// PadSetCache hands back the same read-only PadSet for repeated (seed, options) tuples
+// Entries are keyed by an HMAC of the seed and options under a random per-cache key,
+// so raw seeds are never stored, and the least recently used entry is evicted when
+// the cache is full. The built-in KDFs are keyed by their parameters, custom KDFs
+// only if they implement KDFFingerprinter. It is safe for concurrent use.
+type PadSetCache struct {
+	mu       sync.Mutex
+	key      [32]byte                   // random key for fingerprints
+	capacity int                        // maximum number of entries
+	lru      *list.List                 // entries, most recently used at front
+	entries  map[[32]byte]*list.Element // fingerprint -> element of lru
+}
+
+// cacheEntry is an element of the LRU list
+type cacheEntry struct {
+	fingerprint [32]byte
+	ps          *PadSet
+}
+
+// NewPadSetCache creates a cache holding at most capacity pad sets
+func NewPadSetCache(capacity int) *PadSetCache {
+	if capacity <= 0 {
+		panic(fmt.Sprintf("NewPadSetCache: invalid capacity %d", capacity))
+	}
+
+	c := &PadSetCache{
+		capacity: capacity,
+		lru:      list.New(),
+		entries:  make(map[[32]byte]*list.Element),
+	}
+	if _, err := io.ReadFull(rand.Reader, c.key[:]); err != nil {
+		panic(fmt.Sprintf("NewPadSetCache: failed to generate fingerprint key: %v", err))
+	}
+	return c
+}
+
+// Get returns the cached PadSet for the seed and options, deriving it on a miss
+func (c *PadSetCache) Get(seed []byte, opts *Options) (*PadSet, error) {
+	o, err := opts.validate(seed)
+	if err != nil {
+		return nil, err
+	}
+	return c.get(seed, o)
+}
+
+// Len returns the number of cached pad sets
+func (c *PadSetCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// Purge removes all entries and destroys their pads
+// Pad sets returned earlier must no longer be in use when Purge is called, later use panics with ErrDestroyed.
+func (c *PadSetCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for e := c.lru.Front(); e != nil; e = e.Next() {
+		ps := e.Value.(*cacheEntry).ps
+		ps.evicted = true
+		ps.wipe()
+	}
+	c.lru.Init()
+	clear(c.entries)
+}
+
+// get looks up the validated options, the pads are derived outside of the lock
+// so that a slow derivation does not block hits on other entries.
+func (c *PadSetCache) get(seed []byte, o Options) (*PadSet, error) {
+	fp, ok := c.fingerprint(seed, o)
+	if !ok {
+		return newPadSet(seed, o)
+	}
+
+	c.mu.Lock()
+	if ps := c.hit(fp); ps != nil {
+		c.mu.Unlock()
+		return ps, nil
+	}
+	c.mu.Unlock()
+
+	ps, err := newPadSet(seed, o)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// another goroutine may have derived the same pads meanwhile, keep the first one
+	if hit := c.hit(fp); hit != nil {
+		ps.Destroy()
+		return hit, nil
+	}
+
+	ps.cache, ps.holders = c, 1
+	c.entries[fp] = c.lru.PushFront(&cacheEntry{fingerprint: fp, ps: ps})
+	// evicted pad sets may still be used by sessions, they are wiped once the last holder destroys them
+	for c.lru.Len() > c.capacity {
+		e := c.lru.Back()
+		c.lru.Remove(e)
+		evicted := e.Value.(*cacheEntry).ps
+		delete(c.entries, e.Value.(*cacheEntry).fingerprint)
+		evicted.evicted = true
+		if evicted.holders == 0 {
+			evicted.wipe()
+		}
+	}
+	return ps, nil
+}
+
+// hit returns the cached pad set of the fingerprint with one more holder, or nil
+// The caller holds c.mu.
+func (c *PadSetCache) hit(fp [32]byte) *PadSet {
+	e, ok := c.entries[fp]
+	if !ok {
+		return nil
+	}
+	c.lru.MoveToFront(e)
+	ps := e.Value.(*cacheEntry).ps
+	ps.holders++
+	return ps
+}
+
+// release drops a holder of the pad set, and wipes it if it was the last one of an evicted pad set
+func (c *PadSetCache) release(ps *PadSet) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if ps.holders > 0 {
+		ps.holders--
+	}
+	if ps.evicted && ps.holders == 0 && !ps.destroyed {
+		ps.wipe()
+	}
+}
+
+// fingerprint computes the keyed hash of the seed and every option that affects the pads,
+// it reports false if the KDF cannot be told apart from other KDFs of its type.
+func (c *PadSetCache) fingerprint(seed []byte, o Options) (fp [32]byte, ok bool) {
+	kdf, ok := kdfFingerprint(o.KDF)
+	if !ok {
+		return fp, false
+	}
+
+	mac := hmac.New(sha256.New, c.key[:])
+	writeField(mac, seed)
+	writeField(mac, binary.LittleEndian.AppendUint64(nil, uint64(o.NumPads)))
+	writeField(mac, []byte{o.Qubits})
+	writeField(mac, binary.LittleEndian.AppendUint64(nil, uint64(o.PadSwitch)))
+	writeField(mac, binary.LittleEndian.AppendUint64(nil, uint64(o.Version)))
+	writeField(mac, o.Context)
+	writeField(mac, []byte(fmt.Sprint(o.Unbiased)))
+	writeField(mac, []byte(fmt.Sprintf("%+v", o.Constraints)))
+	writeField(mac, []byte(fmt.Sprint(o.LockMemory)))
+	writeField(mac, binary.LittleEndian.AppendUint64(nil, uint64(o.PRNG)))
+	writeField(mac, kdf)
+	mac.Sum(fp[:0])
+	return fp, true
+}
+
+// kdfFingerprint encodes the normalized parameters of a built-in KDF, or the Fingerprint
+// of a custom KDF prefixed by its type, nil selects the v1 profile.
+func kdfFingerprint(kdf KDF) ([]byte, bool) {
+	switch k := kdf.(type) {
+	case nil:
+		return []byte("v1"), true
+	case PBKDF2:
+		iter := k.Iterations
+		if iter == 0 {
+			iter = PBKDF2_LOOPS
+		}
+		return fmt.Appendf(nil, "PBKDF2 %d %x", iter, hashFingerprint(k.Hash, sha1.New)), true
+	case HKDF:
+		return fmt.Appendf(nil, "HKDF %x", hashFingerprint(k.Hash, sha256.New)), true
+	case Scrypt:
+		n, r, p := k.N, k.R, k.P
+		if n == 0 {
+			n = SCRYPT_N
+		}
+		if r == 0 {
+			r = SCRYPT_R
+		}
+		if p == 0 {
+			p = SCRYPT_P
+		}
+		return fmt.Appendf(nil, "Scrypt %d %d %d", n, r, p), true
+	case Argon2id:
+		time, memory, threads := k.Time, k.Memory, k.Threads
+		if time == 0 {
+			time = ARGON2_TIME
+		}
+		if memory == 0 {
+			memory = ARGON2_MEMORY
+		}
+		if threads == 0 {
+			threads = ARGON2_THREADS
+		}
+		return fmt.Appendf(nil, "Argon2id %d %d %d", time, memory, threads), true
+	case KDFFingerprinter:
+		return append(fmt.Appendf(nil, "%T ", k), k.Fingerprint()...), true
+	}
+	return nil, false
+}
+
+// hashFingerprint identifies a hash function by its digest of a fixed message
+func hashFingerprint(h func() hash.Hash, def func() hash.Hash) []byte {
+	if h == nil {
+		h = def
+	}
+	d := h()
+	d.Write([]byte(HASH_FINGERPRINT_INPUT))
+	return d.Sum(nil)
+}
+
+// writeField writes a length-prefixed field so that adjacent fields cannot be confused
+func writeField(h hash.Hash, field []byte) {
+	h.Write(binary.LittleEndian.AppendUint64(nil, uint64(len(field))))
+	h.Write(field)
+}
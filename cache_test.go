@@ -0,0 +1,190 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPadSetCacheHit(t *testing.T) {
+	seed := make([]byte, 32)
+	io.ReadFull(rand.Reader, seed)
+	cache := NewPadSetCache(4)
+
+	ps1, err := NewPadSet(seed, &Options{NumPads: 7, Cache: cache})
+	assert.Nil(t, err)
+	ps2, err := NewPadSet(seed, &Options{NumPads: 7, Cache: cache})
+	assert.Nil(t, err)
+	assert.True(t, ps1 == ps2, "cache miss on repeated seed")
+	assert.Equal(t, 1, cache.Len())
+
+	uncached, err := NewPadSet(seed, &Options{NumPads: 7})
+	assert.Nil(t, err)
+	assert.Equal(t, uncached.pads, ps1.pads, "cached pads differ")
+
+	// any parameter affecting the pads must miss
+	for _, opts := range []*Options{
+		{NumPads: 11, Cache: cache},
+		{NumPads: 7, Version: PADS_V2, Cache: cache},
+		{NumPads: 7, Context: []byte("tenant"), Cache: cache},
+	} {
+		ps, err := NewPadSet(seed, opts)
+		assert.Nil(t, err)
+		assert.False(t, ps == ps1, "unexpected cache hit for %+v", opts)
+	}
+	assert.Equal(t, 4, cache.Len())
+}
+
+func TestPadSetCacheEviction(t *testing.T) {
+	cache := NewPadSetCache(2)
+	seeds := [][]byte{[]byte("seed-a"), []byte("seed-b"), []byte("seed-c")}
+
+	a, _ := cache.Get(seeds[0], &Options{NumPads: 3})
+	cache.Get(seeds[1], &Options{NumPads: 3})
+	// touch a so that b is the least recently used
+	again, _ := cache.Get(seeds[0], &Options{NumPads: 3})
+	assert.True(t, a == again)
+
+	cache.Get(seeds[2], &Options{NumPads: 3})
+	assert.Equal(t, 2, cache.Len())
+
+	again, _ = cache.Get(seeds[0], &Options{NumPads: 3})
+	assert.True(t, a == again, "most recently used entry evicted")
+}
+
+func TestPadSetCacheEvictionWipes(t *testing.T) {
+	cache := NewPadSetCache(1)
+	held, err := New([]byte("seed-a"), &Options{NumPads: 3, Cache: cache})
+	assert.Nil(t, err)
+	released, err := cache.Get([]byte("seed-b"), &Options{NumPads: 3})
+	assert.Nil(t, err)
+	released.Destroy()
+	assert.False(t, released.destroyed, "cached pads wiped")
+
+	// an evicted pad set nobody holds is wiped at once
+	cache.Get([]byte("seed-c"), &Options{NumPads: 3})
+	assert.True(t, released.destroyed, "evicted pads not wiped")
+	assert.Equal(t, make([]byte, len(released.pads)), released.pads)
+
+	// seed-a was evicted first, but is only wiped when its holder is done
+	assert.False(t, held.PadSet.destroyed, "held pads wiped")
+	assert.NotPanics(t, func() { held.Encrypt([]byte("secret")) })
+	pads := held.pads
+	held.Destroy()
+	assert.True(t, held.PadSet.destroyed, "evicted pads not wiped by their last holder")
+	assert.Equal(t, make([]byte, len(pads)), pads)
+}
+
+func TestPadSetCacheKeyedFingerprint(t *testing.T) {
+	seed := []byte("this seed must never be stored in the cache")
+	o, err := (&Options{NumPads: 3}).validate(seed)
+	assert.Nil(t, err)
+
+	// fingerprints are keyed per cache, so they cannot be precomputed from a guessed seed
+	c1, c2 := NewPadSetCache(2), NewPadSetCache(2)
+	fp1, _ := c1.fingerprint(seed, o)
+	fp2, _ := c2.fingerprint(seed, o)
+	again, _ := c1.fingerprint(seed, o)
+	assert.NotEqual(t, fp1, fp2)
+	assert.Equal(t, fp1, again)
+	assert.NotEqual(t, sha256.Sum256(seed), fp1)
+}
+
+// pepperKDF is a custom KDF whose String hides the pepper it mixes in
+type pepperKDF struct{ pepper string }
+
+func (k pepperKDF) Key(secret, salt []byte, keyLen int) ([]byte, error) {
+	return HKDF{}.Key(append([]byte(k.pepper), secret...), salt, keyLen)
+}
+
+func (k pepperKDF) String() string { return "pepper" }
+
+// fingerprintedKDF is a pepperKDF that PadSetCache may cache
+type fingerprintedKDF struct{ pepperKDF }
+
+func (k fingerprintedKDF) Fingerprint() []byte { return []byte(k.pepper) }
+
+func TestPadSetCacheKDF(t *testing.T) {
+	seed := []byte("seed")
+	cache := NewPadSetCache(8)
+	get := func(kdf KDF) *PadSet {
+		ps, err := cache.Get(seed, &Options{NumPads: 3, KDF: kdf})
+		assert.Nil(t, err)
+		return ps
+	}
+
+	// built-in KDFs hit on equal parameters, defaults included, and miss otherwise
+	assert.True(t, get(HKDF{}) == get(HKDF{Hash: sha256.New}))
+	assert.False(t, get(HKDF{}) == get(HKDF{Hash: sha512.New}))
+	assert.True(t, get(PBKDF2{Iterations: 2}) == get(PBKDF2{Iterations: 2, Hash: sha1.New}))
+	assert.False(t, get(PBKDF2{Iterations: 2}) == get(PBKDF2{Iterations: 3}))
+
+	// custom KDFs printing the same are derived without caching
+	a, b := get(pepperKDF{"A"}), get(pepperKDF{"B"})
+	assert.NotEqual(t, a.pads, b.pads, "pads of another KDF returned")
+	assert.False(t, a == get(pepperKDF{"A"}), "custom KDF cached")
+	assert.Equal(t, 4, cache.Len())
+
+	// unless they implement KDFFingerprinter
+	assert.True(t, get(fingerprintedKDF{pepperKDF{"A"}}) == get(fingerprintedKDF{pepperKDF{"A"}}))
+	assert.False(t, get(fingerprintedKDF{pepperKDF{"A"}}) == get(fingerprintedKDF{pepperKDF{"B"}}))
+	assert.Equal(t, 6, cache.Len())
+}
+
+func TestPadSetCachePurge(t *testing.T) {
+	cache := NewPadSetCache(2)
+	ps, err := cache.Get([]byte("seed"), &Options{NumPads: 3})
+	assert.Nil(t, err)
+
+	cache.Purge()
+	assert.Equal(t, 0, cache.Len())
+	assert.Equal(t, make([]byte, len(ps.pads)), ps.pads, "pads not zeroed")
+	assert.Equal(t, make([]byte, len(ps.rpads)), ps.rpads, "rpads not zeroed")
+
+	fresh, err := cache.Get([]byte("seed"), &Options{NumPads: 3})
+	assert.Nil(t, err)
+	assert.False(t, fresh == ps)
+}
+
+func TestPadSetCacheConcurrent(t *testing.T) {
+	cache := NewPadSetCache(2)
+	results := make([]*PadSet, 16)
+
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], _ = cache.Get([]byte("shared seed"), &Options{NumPads: 3})
+		}()
+	}
+	wg.Wait()
+
+	// all callers finishing after the first insert get the same pad set
+	final, _ := cache.Get([]byte("shared seed"), &Options{NumPads: 3})
+	for _, ps := range results {
+		assert.Equal(t, final.pads, ps.pads)
+	}
+	assert.Equal(t, 1, cache.Len())
+}
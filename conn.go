@@ -0,0 +1,233 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+import (
+	"crypto/rand"
+	"io"
+	"net"
+	"sync"
+)
+
+// Config holds the key material shared by all connections of a seed, derived once
+// by NewConfig, so that setting up a connection only costs an HMAC per direction.
+type Config struct {
+	pads [2]*PadSet  // pads of each direction, indexed by the sending role - 1
+	keys [2]*PRNGKey // per-connection PRNG keys of each direction
+}
+
+// NewConfig derives the pads and per-direction PRNG keys of the seed for Client, Server and Listen
+// With opts.SeparatePads each direction has its own pad set. 16-qubit pads need every
+// write to hold a whole number of symbols, as a split symbol is held back.
+func NewConfig(seed []byte, opts *Options) (*Config, error) {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+
+	c := &Config{}
+	var err error
+	// a failure destroys the pad sets and keys derived so far
+	defer func() {
+		if err != nil {
+			c.Destroy()
+		}
+	}()
+	if o.SeparatePads {
+		if c.pads[0], err = newDirectionPadSet(seed, o, DIRECTION_INITIATOR_TO_RESPONDER); err != nil {
+			return nil, err
+		}
+		if c.pads[1], err = newDirectionPadSet(seed, o, DIRECTION_RESPONDER_TO_INITIATOR); err != nil {
+			return nil, err
+		}
+	} else {
+		if c.pads[0], err = NewPadSet(seed, &o); err != nil {
+			return nil, err
+		}
+		c.pads[1] = c.pads[0]
+	}
+
+	for i, label := range []string{DIRECTION_INITIATOR_TO_RESPONDER, DIRECTION_RESPONDER_TO_INITIATOR} {
+		if c.keys[i], err = newPRNGKey(seed, c.pads[i].derive.withDirection(label, o.Context)); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Destroy wipes the PRNG keys and the pads, pads from a PadSetCache are released as by PadSet.Destroy
+// Connections created from the config must be closed first.
+func (c *Config) Destroy() {
+	for _, k := range c.keys {
+		if k != nil {
+			k.Destroy()
+		}
+	}
+	if c.pads[0] != nil {
+		c.pads[0].Destroy()
+	}
+	if c.pads[1] != nil && c.pads[1] != c.pads[0] {
+		c.pads[1].Destroy()
+	}
+}
+
+// Conn is a net.Conn encrypting writes and decrypting reads
+// Each side picks a random nonce for the direction it sends, and sends it in the clear
+// ahead of its first write, so no two connections share a selector stream.
+// Reads and writes may run concurrently, deadlines apply to the underlying connection.
+// A failed write leaves the stream out of step with the peer, later writes return the same error
+// and the connection must be closed.
+type Conn struct {
+	net.Conn
+	cfg  *Config
+	role Role
+
+	writeMu sync.Mutex
+	w       *Writer // nil until the nonce is sent
+	err     error   // sticky error of sending the nonce
+
+	readMu   sync.Mutex
+	r        *Reader // nil until the nonce is received
+	nonce    [NONCE_SIZE]byte
+	nonceLen int // bytes of the peer nonce received so far
+
+	closeOnce sync.Once
+}
+
+// Client returns the initiator side of a connection encrypted with the config
+func Client(conn net.Conn, cfg *Config) *Conn {
+	return &Conn{Conn: conn, cfg: cfg, role: ROLE_INITIATOR}
+}
+
+// Server returns the responder side of a connection encrypted with the config
+func Server(conn net.Conn, cfg *Config) *Conn {
+	return &Conn{Conn: conn, cfg: cfg, role: ROLE_RESPONDER}
+}
+
+// Write encrypts p and writes it to the connection, p itself is left untouched
+func (c *Conn) Write(p []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.err != nil {
+		return 0, c.err
+	}
+	if c.w == nil {
+		// part of the nonce may have reached the peer, so a retry would desync the stream
+		if c.err = c.sendNonce(); c.err != nil {
+			return 0, c.err
+		}
+	}
+	return c.w.Write(p)
+}
+
+// sendNonce picks the nonce of the sending direction, writes it and sets up the Writer
+func (c *Conn) sendNonce() error {
+	var nonce [NONCE_SIZE]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return err
+	}
+	send := c.role - 1
+	rd, err := c.cfg.keys[send].PRNG(nonce[:])
+	if err != nil {
+		return err
+	}
+	if _, err := c.Conn.Write(nonce[:]); err != nil {
+		rd.Destroy()
+		return err
+	}
+	c.w = NewWriter(c.Conn, c.cfg.pads[send], rd)
+	return nil
+}
+
+// Read reads and decrypts data from the connection
+// A read interrupted by a deadline can be retried, the stream stays in step.
+func (c *Conn) Read(p []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	if c.r == nil {
+		for c.nonceLen < NONCE_SIZE {
+			n, err := c.Conn.Read(c.nonce[c.nonceLen:])
+			c.nonceLen += n
+			if err != nil {
+				if err == io.EOF && c.nonceLen > 0 {
+					err = io.ErrUnexpectedEOF
+				}
+				return 0, err
+			}
+		}
+		recv := 2 - c.role
+		rd, err := c.cfg.keys[recv].PRNG(c.nonce[:])
+		if err != nil {
+			return 0, err
+		}
+		c.r = NewReader(c.Conn, c.cfg.pads[recv], rd)
+	}
+	return c.r.Read(p)
+}
+
+// Close closes the connection, then wipes the PRNGs once pending reads and writes return
+func (c *Conn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(func() {
+		c.writeMu.Lock()
+		if c.w != nil {
+			c.w.release()
+			c.w.sel.(*Rand).Destroy()
+		}
+		c.writeMu.Unlock()
+
+		c.readMu.Lock()
+		if c.r != nil {
+			c.r.release()
+			c.r.sel.(*Rand).Destroy()
+		}
+		clear(c.nonce[:])
+		c.readMu.Unlock()
+	})
+	return err
+}
+
+// listener accepts connections encrypted with a config
+type listener struct {
+	net.Listener
+	cfg *Config
+}
+
+// Listen announces on the local network address, and returns a listener
+// whose accepted connections are Server connections encrypted with the config.
+func Listen(network, addr string, cfg *Config) (net.Listener, error) {
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewListener(l, cfg), nil
+}
+
+// NewListener wraps an existing listener so that its accepted connections are Server connections
+func NewListener(l net.Listener, cfg *Config) net.Listener {
+	return &listener{Listener: l, cfg: cfg}
+}
+
+// Accept waits for the next connection and returns it as a Server connection
+func (l *listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return Server(conn, l.cfg), nil
+}
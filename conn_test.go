@@ -0,0 +1,248 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// loopback returns a client connection to an echo server listening with the config
+func loopback(t *testing.T, cfg *Config) *Conn {
+	l, err := Listen("tcp", "127.0.0.1:0", cfg)
+	assert.Nil(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	assert.Nil(t, err)
+	client := Client(conn, cfg)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestConnEcho(t *testing.T) {
+	for _, separate := range []bool{false, true} {
+		cfg, err := NewConfig([]byte("shared seed"), &Options{NumPads: 977, SeparatePads: separate})
+		assert.Nil(t, err)
+		client := loopback(t, cfg)
+
+		for _, size := range []int{1, 7, 1000, 100000} {
+			msg := make([]byte, size)
+			io.ReadFull(rand.Reader, msg)
+			original := append([]byte(nil), msg...)
+
+			n, err := client.Write(msg)
+			assert.Nil(t, err)
+			assert.Equal(t, size, n)
+			assert.Equal(t, original, msg, "source modified")
+
+			echo := make([]byte, size)
+			_, err = io.ReadFull(client, echo)
+			assert.Nil(t, err)
+			assert.Equal(t, original, echo, "echo differs")
+		}
+	}
+}
+
+func TestConnWire(t *testing.T) {
+	seed := []byte("shared seed")
+	cfg, err := NewConfig(seed, &Options{NumPads: 977})
+	assert.Nil(t, err)
+
+	// the same plaintext on two connections must give different ciphertexts
+	msg := bytes.Repeat([]byte("attack at dawn "), 100)
+	var wires [][]byte
+	for range 2 {
+		a, b := net.Pipe()
+		client := Client(a, cfg)
+		go func() {
+			client.Write(msg)
+			client.Close()
+		}()
+		wire, err := io.ReadAll(b)
+		assert.Nil(t, err)
+		assert.Len(t, wire, NONCE_SIZE+len(msg))
+		assert.NotContains(t, string(wire), "attack at dawn")
+		wires = append(wires, wire)
+
+		// the initiator stream is derived from the nonce sent ahead of the data
+		key, err := newPRNGKey(seed, cfg.pads[0].derive.withDirection(DIRECTION_INITIATOR_TO_RESPONDER, nil))
+		assert.Nil(t, err)
+		rd, err := key.PRNG(wire[:NONCE_SIZE])
+		assert.Nil(t, err)
+		cfg.pads[0].DecryptWithPRNG(wire[NONCE_SIZE:], rd)
+		assert.Equal(t, msg, wire[NONCE_SIZE:])
+	}
+	assert.NotEqual(t, wires[0], wires[1], "connections share a keystream")
+}
+
+func TestConnDeadline(t *testing.T) {
+	cfg, err := NewConfig([]byte("shared seed"), &Options{NumPads: 977})
+	assert.Nil(t, err)
+	client := loopback(t, cfg)
+
+	// a read interrupted by a deadline, before and after the nonce, can be retried
+	buf := make([]byte, 10)
+	for _, msg := range []string{"first", "second"} {
+		client.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+		_, err = client.Read(buf)
+		assert.True(t, errors.Is(err, os.ErrDeadlineExceeded), "expected timeout, got %v", err)
+
+		client.SetReadDeadline(time.Time{})
+		client.Write([]byte(msg))
+		n, err := io.ReadFull(client, buf[:len(msg)])
+		assert.Nil(t, err)
+		assert.Equal(t, msg, string(buf[:n]))
+	}
+}
+
+func TestConnConcurrent(t *testing.T) {
+	cfg, err := NewConfig([]byte("shared seed"), &Options{NumPads: 977})
+	assert.Nil(t, err)
+	client := loopback(t, cfg)
+
+	// writes are atomic, so every block arrives whole even with concurrent writers
+	const writers, blocks, blockSize = 4, 50, 1000
+	var wg sync.WaitGroup
+	for i := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			block := bytes.Repeat([]byte{byte(i + 1)}, blockSize)
+			for range blocks {
+				_, err := client.Write(block)
+				assert.Nil(t, err)
+			}
+		}()
+	}
+
+	// concurrent readers split the stream between them, together they see every byte
+	const readers = 2
+	counts := make([][writers + 1]int, readers)
+	var total sync.WaitGroup
+	remaining := make(chan int, 1)
+	remaining <- writers * blocks * blockSize
+	for i := range readers {
+		total.Add(1)
+		go func() {
+			defer total.Done()
+			buf := make([]byte, 777)
+			for {
+				left := <-remaining
+				if left == 0 {
+					remaining <- 0
+					return
+				}
+				n, err := client.Read(buf[:min(len(buf), left)])
+				remaining <- left - n
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				for _, b := range buf[:n] {
+					counts[i][b]++
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	total.Wait()
+
+	for v := 1; v <= writers; v++ {
+		sum := 0
+		for i := range readers {
+			sum += counts[i][v]
+		}
+		assert.Equal(t, blocks*blockSize, sum, "bytes of writer %d", v)
+	}
+}
+
+// failConn fails its first write
+type failConn struct {
+	net.Conn
+	writes int
+}
+
+func (c *failConn) Write(p []byte) (int, error) {
+	c.writes++
+	if c.writes == 1 {
+		return 0, errors.New("write failed")
+	}
+	return c.Conn.Write(p)
+}
+
+func TestConnWriteError(t *testing.T) {
+	cfg, err := NewConfig([]byte("shared seed"), &Options{NumPads: 977})
+	assert.Nil(t, err)
+
+	// a failed nonce must not be followed by another one on the same connection
+	a, b := net.Pipe()
+	defer b.Close()
+	conn := &failConn{Conn: a}
+	client := Client(conn, cfg)
+	defer client.Close()
+
+	_, err = client.Write([]byte("hello"))
+	assert.NotNil(t, err)
+	_, err2 := client.Write([]byte("hello"))
+	assert.Equal(t, err, err2)
+	assert.Equal(t, 1, conn.writes)
+}
+
+func TestConnClose(t *testing.T) {
+	cfg, err := NewConfig([]byte("shared seed"), &Options{NumPads: 977})
+	assert.Nil(t, err)
+	client := loopback(t, cfg)
+
+	client.Write([]byte("hello"))
+	io.ReadFull(client, make([]byte, 5))
+	w, r := client.w.sel.(*Rand), client.r.sel.(*Rand)
+	assert.Nil(t, client.Close())
+	assert.True(t, w.destroyed && r.destroyed, "PRNGs not wiped")
+
+	_, err = client.Write([]byte("hello"))
+	assert.NotNil(t, err)
+	assert.NotNil(t, client.Close())
+
+	// the echo server may still use cfg, destroy another config
+	other, err := NewConfig([]byte("other seed"), &Options{NumPads: 977})
+	assert.Nil(t, err)
+	other.Destroy()
+	_, err = other.keys[0].PRNG(make([]byte, NONCE_SIZE))
+	assert.ErrorIs(t, err, ErrDestroyed)
+}
@@ -0,0 +1,151 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// MAX_PAD_ATTEMPTS is the number of shuffles tried per pad before the constraints are deemed unsatisfiable
+const MAX_PAD_ATTEMPTS = 1 << 16
+
+// Errors returned for pad constraints
+var (
+	ErrInvalidConstraints       = errors.New("qpp: invalid pad constraints")
+	ErrConstraintsUnsatisfiable = errors.New("qpp: pad constraints unsatisfiable")
+)
+
+// PadConstraints restricts the cycle structure of the generated pads
+// A pad produced by the shuffle may contain fixed points, i.e. symbols that are
+// left unchanged, or very short cycles; the constraints rule these out.
+type PadConstraints struct {
+	Derangement    bool   // No fixed points, equivalent to MinCycleLength 2
+	MinCycleLength int    // Minimum length of every cycle of the pad
+	MinOrder       uint64 // Minimum order of the pad, the lcm of its cycle lengths
+}
+
+// validate rejects constraints that no pad of the given number of qubits can meet
+func (c *PadConstraints) validate(qubits uint8) error {
+	if c == nil {
+		return nil
+	}
+
+	n := 1 << qubits
+	if c.MinCycleLength < 0 || c.MinCycleLength > n {
+		return fmt.Errorf("%w: minimum cycle length %d, must be in [0, %d]", ErrInvalidConstraints, c.MinCycleLength, n)
+	}
+
+	// cycles longer than half the symbols leave room for a single cycle of order n,
+	// otherwise the order is bounded by Landau's function
+	maxOrder := landau(n)
+	if c.MinCycleLength > n/2 {
+		maxOrder = big.NewInt(int64(n))
+	}
+	if new(big.Int).SetUint64(c.MinOrder).Cmp(maxOrder) > 0 {
+		return fmt.Errorf("%w: minimum order %d, at most %v for %d symbols", ErrInvalidConstraints, c.MinOrder, maxOrder, n)
+	}
+	return nil
+}
+
+// landau returns Landau's function g(n), the largest order of a permutation of n symbols
+// g(512) already exceeds 2^64, so larger n are capped at 512 symbols.
+func landau(n int) *big.Int {
+	n = min(n, 512)
+
+	// g[j] is the largest product of powers of distinct primes summing to at most j,
+	// built as a knapsack over the powers of each prime in turn
+	g := make([]*big.Int, n+1)
+	for j := range g {
+		g[j] = big.NewInt(1)
+	}
+	for p := 2; p <= n; p++ {
+		if !big.NewInt(int64(p)).ProbablyPrime(0) {
+			continue
+		}
+		for j := n; j >= p; j-- {
+			for q := p; q <= j; q *= p {
+				v := new(big.Int).Mul(g[j-q], big.NewInt(int64(q)))
+				if v.Cmp(g[j]) > 0 {
+					g[j] = v
+				}
+			}
+		}
+	}
+	return g[n]
+}
+
+// satisfied reports whether the pad meets the constraints, nil constraints are always met
+func (c *PadConstraints) satisfied(pad any) bool {
+	if c == nil {
+		return true
+	}
+
+	var lengths []int
+	switch pad := pad.(type) {
+	case []byte:
+		lengths = cycleLengths(pad)
+	case []uint16:
+		lengths = cycleLengths(pad)
+	}
+
+	minCycle := c.MinCycleLength
+	if c.Derangement {
+		minCycle = max(minCycle, 2)
+	}
+	for _, l := range lengths {
+		if l < minCycle {
+			return false
+		}
+	}
+
+	if c.MinOrder > 1 {
+		return permutationOrder(lengths).Cmp(new(big.Int).SetUint64(c.MinOrder)) >= 0
+	}
+	return true
+}
+
+// cycleLengths returns the length of every cycle of the permutation
+func cycleLengths[T byte | uint16](pad []T) []int {
+	var lengths []int
+	visited := make([]bool, len(pad))
+	for i := range pad {
+		if visited[i] {
+			continue
+		}
+
+		l := 0
+		for j := i; !visited[j]; j = int(pad[j]) {
+			visited[j] = true
+			l++
+		}
+		lengths = append(lengths, l)
+	}
+	return lengths
+}
+
+// permutationOrder returns the lcm of the cycle lengths, which may exceed 64 bits for 16-qubit pads
+func permutationOrder(lengths []int) *big.Int {
+	order := big.NewInt(1)
+	g := new(big.Int)
+	for _, l := range lengths {
+		bl := big.NewInt(int64(l))
+		g.GCD(nil, nil, order, bl)
+		order.Mul(order, bl.Div(bl, g))
+	}
+	return order
+}
@@ -0,0 +1,106 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+import (
+	"crypto/rand"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCycleLengths(t *testing.T) {
+	// (0 1 2)(3 4)(5)
+	pad := []byte{1, 2, 0, 4, 3, 5}
+	assert.Equal(t, []int{3, 2, 1}, cycleLengths(pad))
+	assert.Equal(t, int64(6), permutationOrder(cycleLengths(pad)).Int64())
+
+	c := &PadConstraints{Derangement: true}
+	assert.False(t, c.satisfied(pad))
+	assert.True(t, c.satisfied([]byte{1, 2, 0, 4, 3}))
+	assert.False(t, (&PadConstraints{MinCycleLength: 3}).satisfied([]byte{1, 2, 0, 4, 3}))
+	assert.True(t, (&PadConstraints{MinOrder: 6}).satisfied(pad))
+	assert.False(t, (&PadConstraints{MinOrder: 7}).satisfied(pad))
+	assert.True(t, (*PadConstraints)(nil).satisfied(pad))
+}
+
+func TestConstrainedPads(t *testing.T) {
+	seed := make([]byte, 32)
+	io.ReadFull(rand.Reader, seed)
+
+	for _, version := range []int{PADS_V1, PADS_V2} {
+		for _, c := range []*PadConstraints{
+			{Derangement: true},
+			{MinCycleLength: 8},
+			{Derangement: true, MinOrder: 1_000_000},
+		} {
+			plain, err := NewPadSet(seed, &Options{NumPads: 31, Version: version})
+			assert.Nil(t, err)
+			constrained, err := NewPadSet(seed, &Options{NumPads: 31, Version: version, Constraints: c})
+			assert.Nil(t, err)
+			again, err := NewPadSet(seed, &Options{NumPads: 31, Version: version, Constraints: c, Workers: 3})
+			assert.Nil(t, err)
+			assert.Equal(t, constrained.pads, again.pads, "constrained pads not deterministic")
+
+			for i := range 31 {
+				pad := constrained.pads[i*256 : (i+1)*256]
+				assert.True(t, c.satisfied(pad), "pad %d violates %+v", i, c)
+				for j := range 256 {
+					assert.Equal(t, byte(j), constrained.rpads[i*256+int(pad[j])], "not reversible")
+				}
+
+				// pads meeting the constraints on the first shuffle are kept
+				if original := plain.pads[i*256 : (i+1)*256]; c.satisfied(original) {
+					assert.Equal(t, original, pad)
+				}
+			}
+		}
+	}
+}
+
+func TestConstrainedPadsInvalid(t *testing.T) {
+	seed := make([]byte, 32)
+	io.ReadFull(rand.Reader, seed)
+
+	_, err := New(seed, &Options{NumPads: 3, Constraints: &PadConstraints{MinCycleLength: 257}})
+	assert.ErrorIs(t, err, ErrInvalidConstraints)
+	_, err = New(seed, &Options{NumPads: 3, Constraints: &PadConstraints{MinCycleLength: -1}})
+	assert.ErrorIs(t, err, ErrInvalidConstraints)
+
+	// the largest order of a permutation of 16 symbols is 140
+	_, err = New(seed, &Options{NumPads: 3, Qubits: 4, Constraints: &PadConstraints{MinOrder: 141}})
+	assert.ErrorIs(t, err, ErrInvalidConstraints)
+	_, err = New(seed, &Options{NumPads: 3, Qubits: 4, Constraints: &PadConstraints{MinCycleLength: 9, MinOrder: 17}})
+	assert.ErrorIs(t, err, ErrInvalidConstraints)
+
+	// cycles of at least 6 symbols reach an order of 63 at most, below Landau's bound
+	_, err = New(seed, &Options{NumPads: 3, Qubits: 4, Constraints: &PadConstraints{MinCycleLength: 6, MinOrder: 100}})
+	assert.ErrorIs(t, err, ErrConstraintsUnsatisfiable)
+}
+
+func TestLandau(t *testing.T) {
+	// OEIS A000793
+	expected := []int64{1, 1, 2, 3, 4, 6, 6, 12, 15, 20, 30, 30, 60, 60, 84, 105, 140, 210, 210, 420, 420}
+	for n, g := range expected {
+		assert.Equal(t, g, landau(n).Int64(), "g(%d)", n)
+	}
+
+	// every uint64 order is reachable with 16 qubits
+	assert.Greater(t, landau(512).BitLen(), 64)
+	assert.Nil(t, (&PadConstraints{MinOrder: math.MaxUint64}).validate(16))
+}
@@ -0,0 +1,179 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+
+	"golang.org/x/crypto/chacha20"
+)
+
+// Selector PRNG algorithms
+const (
+	PRNG_XOSHIRO  = 1 // xoshiro256**, fast but linear, its state can be recovered from a few outputs
+	PRNG_CHACHA20 = 2 // ChaCha20 keystream, a cryptographically secure generator
+	PRNG_AES_CTR  = 3 // AES-256-CTR keystream, a cryptographically secure generator using AES-NI where available
+)
+
+// ErrInvalidPRNG is returned for an unknown selector PRNG algorithm
+var ErrInvalidPRNG = errors.New("qpp: invalid PRNG algorithm")
+
+// chachaChunks is the number of chunks of buf in a period of the ChaCha20 block counter
+const chachaChunks = (1 << 32) / (512 / 64)
+
+// keystream draws 64-bit words from the keystream of a stream cipher
+// The key is kept so that the keystream can be restarted at any chunk of buf.
+type keystream struct {
+	stream cipher.Stream
+	key    [32]byte
+	prng   int
+	buf    [512]byte
+	off    int
+	chunk  uint64 // next chunk of buf to be generated
+}
+
+// newKeystream creates the keystream of the given algorithm keyed by a 32-byte key
+// The key is unique to the seed, so the nonce or IV only carries the block counter.
+func newKeystream(key []byte, prng int) (*keystream, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("%w: key length %d", ErrInvalidPRNG, len(key))
+	}
+	ks := &keystream{prng: prng}
+	copy(ks.key[:], key)
+	if err := ks.reset(0); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// reset restarts the stream cipher at the given chunk of len(buf) bytes and empties buf
+func (ks *keystream) reset(chunk uint64) error {
+	switch ks.prng {
+	case PRNG_CHACHA20:
+		// the 32-bit block counter of ChaCha20 carries into the 96-bit nonce,
+		// so the keystream does not end after 2^32 blocks of 64 bytes
+		hi, lo := bits.Mul64(chunk, uint64(len(ks.buf)/64))
+		var nonce [chacha20.NonceSize]byte
+		binary.LittleEndian.PutUint32(nonce[:4], uint32(lo>>32))
+		binary.LittleEndian.PutUint64(nonce[4:], hi)
+		c, err := chacha20.NewUnauthenticatedCipher(ks.key[:], nonce[:])
+		if err != nil {
+			return err
+		}
+		c.SetCounter(uint32(lo))
+		ks.stream = c
+	case PRNG_AES_CTR:
+		block, err := aes.NewCipher(ks.key[:])
+		if err != nil {
+			return err
+		}
+		// the IV is the 128-bit big-endian block counter
+		var iv [aes.BlockSize]byte
+		hi, lo := bits.Mul64(chunk, uint64(len(ks.buf)/aes.BlockSize))
+		binary.BigEndian.PutUint64(iv[:8], hi)
+		binary.BigEndian.PutUint64(iv[8:], lo)
+		ks.stream = cipher.NewCTR(block, iv[:])
+	default:
+		return fmt.Errorf("%w: %d", ErrInvalidPRNG, ks.prng)
+	}
+	ks.off = len(ks.buf)
+	ks.chunk = chunk
+	return nil
+}
+
+// seek positions the keystream at the given 64-bit word
+func (ks *keystream) seek(words uint64) error {
+	perChunk := uint64(len(ks.buf) / 8)
+	if err := ks.reset(words / perChunk); err != nil {
+		return err
+	}
+	ks.fill()
+	ks.off = int(words%perChunk) * 8
+	return nil
+}
+
+// fill refills buf with the next chunk of the keystream
+func (ks *keystream) fill() {
+	// restart ChaCha20 with the carry in its nonce when the block counter wraps
+	if ks.prng == PRNG_CHACHA20 && ks.chunk != 0 && ks.chunk%chachaChunks == 0 {
+		ks.reset(ks.chunk)
+	}
+	clear(ks.buf[:])
+	ks.stream.XORKeyStream(ks.buf[:], ks.buf[:])
+	ks.off = 0
+	ks.chunk++
+}
+
+// position returns the number of 64-bit words drawn from the start of the keystream
+func (ks *keystream) position() uint64 {
+	return ks.chunk*uint64(len(ks.buf)/8) - uint64(len(ks.buf)-ks.off)/8
+}
+
+// uint64 returns the next 64-bit word of the keystream
+func (ks *keystream) uint64() uint64 {
+	if ks.off == len(ks.buf) {
+		ks.fill()
+	}
+	x := binary.LittleEndian.Uint64(ks.buf[ks.off:])
+	ks.off += 8
+	return x
+}
+
+// newRand creates a Rand of the given algorithm from a 32-byte key
+func newRand(key []byte, prng int) (*Rand, error) {
+	rd := &Rand{}
+	if prng == PRNG_XOSHIRO {
+		rd.xoshiro[0] = binary.LittleEndian.Uint64(key[0:8])
+		rd.xoshiro[1] = binary.LittleEndian.Uint64(key[8:16])
+		rd.xoshiro[2] = binary.LittleEndian.Uint64(key[16:24])
+		rd.xoshiro[3] = binary.LittleEndian.Uint64(key[24:32])
+		rd.origin = rd.xoshiro
+	} else {
+		ks, err := newKeystream(key, prng)
+		if err != nil {
+			return nil, err
+		}
+		rd.keystream = ks
+	}
+	rd.seed64 = rd.next()
+	return rd, nil
+}
+
+// CreatePRNGWith is CreatePRNG with a choice of the PRNG algorithm, it panics if prng is unknown
+// PRNG_CHACHA20 and PRNG_AES_CTR trade some speed for a selector stream that cannot be predicted.
+func CreatePRNGWith(seed []byte, prng int) *Rand {
+	d := v1Derivation
+	d.prng = prng
+	rd, err := createPRNG(seed, d)
+	if err != nil {
+		panic(fmt.Sprintf("CreatePRNGWith: %v", err))
+	}
+	return rd
+}
+
+// FastPRNGWith is FastPRNG with a choice of the PRNG algorithm, it panics if prng is unknown
+func FastPRNGWith(seed []byte, prng int) *Rand {
+	rd, err := fastPRNG(seed, prng)
+	if err != nil {
+		panic(fmt.Sprintf("FastPRNGWith: %v", err))
+	}
+	return rd
+}
@@ -0,0 +1,98 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+import (
+	"crypto/rand"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSPRNG(t *testing.T) {
+	seed := make([]byte, 32)
+	io.ReadFull(rand.Reader, seed)
+
+	for _, prng := range []int{PRNG_CHACHA20, PRNG_AES_CTR} {
+		qpp, err := New(seed, &Options{NumPads: 977, PRNG: prng})
+		assert.Nil(t, err)
+
+		original := make([]byte, 65536)
+		io.ReadFull(rand.Reader, original)
+		msg := append([]byte(nil), original...)
+		expected := append([]byte(nil), original...)
+
+		// the keystream must not depend on how the message is split
+		r1, r2 := qpp.CreatePRNG(seed), CreatePRNGWith(seed, prng)
+		qpp.EncryptWithPRNG(expected, r1)
+		encryptChunked(msg, 29, 1, func(b []byte) { qpp.EncryptWithSelector(b, opaqueSelector{r2}) })
+		assert.Equal(t, expected, msg, "chunked encryption differs")
+
+		msg = append(msg[:0], original...)
+		qpp.Encrypt(msg)
+		assert.Equal(t, expected, msg, "New does not use the PRNG option")
+		encryptChunked(msg, 31, 1, qpp.Decrypt)
+		assert.Equal(t, original, msg, "not equal")
+
+		// a different generator gives a different stream
+		xoshiro := append([]byte(nil), original...)
+		NewQPP(seed, 977).Encrypt(xoshiro)
+		assert.NotEqual(t, expected, xoshiro)
+		assert.NotEqual(t, FastPRNG(seed).Uint64(), FastPRNGWith(seed, prng).Uint64())
+		assert.Equal(t, FastPRNGWith(seed, prng).Uint64(), FastPRNGWith(seed, prng).Uint64())
+	}
+
+	assert.Equal(t, *FastPRNG(seed), *FastPRNGWith(seed, PRNG_XOSHIRO))
+	assert.Equal(t, *CreatePRNG(seed), *CreatePRNGWith(seed, PRNG_XOSHIRO))
+
+	_, err := New(seed, &Options{NumPads: 977, PRNG: 4})
+	assert.ErrorIs(t, err, ErrInvalidPRNG)
+	assert.Panics(t, func() { FastPRNGWith(seed, 4) })
+}
+
+func TestCSPRNGDestroy(t *testing.T) {
+	rand := FastPRNGWith([]byte("seed"), PRNG_CHACHA20)
+	ks := rand.keystream
+	rand.Destroy()
+	assert.Equal(t, [512]byte{}, ks.buf, "keystream not wiped")
+	assert.Nil(t, rand.keystream)
+}
+
+func BenchmarkSelectorPRNG(b *testing.B) {
+	seed := make([]byte, 32)
+	io.ReadFull(rand.Reader, seed)
+	qpp := NewQPP(seed, 977)
+	msg := make([]byte, 65536)
+	io.ReadFull(rand.Reader, msg)
+
+	for _, bench := range []struct {
+		name string
+		prng int
+	}{
+		{"xoshiro256**", PRNG_XOSHIRO},
+		{"ChaCha20", PRNG_CHACHA20},
+		{"AES-CTR", PRNG_AES_CTR},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			rand := FastPRNGWith(seed, bench.prng)
+			b.SetBytes(int64(len(msg)))
+			for i := 0; i < b.N; i++ {
+				qpp.EncryptWithPRNG(msg, rand)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+import "errors"
+
+// ErrDestroyed is the panic value of encrypting or decrypting with destroyed key material
+var ErrDestroyed = errors.New("qpp: key material has been destroyed")
+
+// Destroy overwrites the pads with zeros and releases locked memory, later encryption or decryption panics with ErrDestroyed
+// The pad set must no longer be in use by other goroutines when Destroy is called.
+// A pad set from a PadSetCache is only released by Destroy, it is wiped once the cache
+// evicted it and every NewPadSet or Get that returned it has been matched by a Destroy.
+func (ps *PadSet) Destroy() {
+	if ps.cache != nil {
+		ps.cache.release(ps)
+		return
+	}
+	ps.wipe()
+}
+
+// wipe overwrites the pads with zeros and releases locked memory
+func (ps *PadSet) wipe() {
+	ps.destroyed = true
+	// 16-qubit tables share memory with pads and rpads
+	clear(ps.pads)
+	clear(ps.rpads)
+	ps.freeTables()
+}
+
+// Destroy overwrites the PRNG state with zeros, later encryption or decryption panics with ErrDestroyed
+func (r *Rand) Destroy() {
+	// the key schedule inside the stream cipher cannot be reached, only the key and the buffered keystream are wiped
+	if r.keystream != nil {
+		clear(r.keystream.key[:])
+		clear(r.keystream.buf[:])
+	}
+	*r = Rand{destroyed: true}
+}
+
+// Destroy wipes the PRNGs of the session, the pad set may be shared and is left untouched
+func (s *Session) Destroy() {
+	s.encRand.Destroy()
+	s.decRand.Destroy()
+}
+
+// Destroy wipes the PRNGs and the pads, pads from a PadSetCache are released as by PadSet.Destroy
+// Later calls to Encrypt or Decrypt panic with ErrDestroyed instead of using zeroed tables.
+func (qpp *QuantumPermutationPad) Destroy() {
+	qpp.Session.Destroy()
+	qpp.PadSet.Destroy()
+}
+
+// Close destroys the key material of the instance, it implements io.Closer and always returns nil
+func (qpp *QuantumPermutationPad) Close() error {
+	qpp.Destroy()
+	return nil
+}
+
+// checkAlive panics with ErrDestroyed if the pads or the PRNG, when not nil, have been destroyed
+func (ps *PadSet) checkAlive(rand *Rand) {
+	if ps.destroyed || (rand != nil && rand.destroyed) {
+		panic(ErrDestroyed)
+	}
+}
@@ -0,0 +1,178 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDestroy(t *testing.T) {
+	qpp := NewQPP([]byte("destroy me"), 7)
+	pads, rpads := qpp.pads, qpp.rpads
+
+	var _ io.Closer = qpp
+	assert.Nil(t, qpp.Close())
+	assert.Equal(t, make([]byte, len(pads)), pads, "pads not zeroed")
+	assert.Equal(t, make([]byte, len(rpads)), rpads, "rpads not zeroed")
+	assert.Equal(t, Rand{destroyed: true}, *qpp.encRand, "encryption PRNG not zeroed")
+	assert.Equal(t, Rand{destroyed: true}, *qpp.decRand, "decryption PRNG not zeroed")
+
+	assert.PanicsWithValue(t, ErrDestroyed, func() { qpp.Encrypt([]byte("secret")) })
+	assert.PanicsWithValue(t, ErrDestroyed, func() { qpp.Decrypt([]byte("secret")) })
+
+	// destroying twice is harmless
+	assert.Nil(t, qpp.Close())
+}
+
+func TestDestroyRand(t *testing.T) {
+	qpp := NewQPP([]byte("destroy me"), 7)
+	rand := FastPRNG([]byte("rand"))
+	rand.Destroy()
+
+	assert.PanicsWithValue(t, ErrDestroyed, func() { qpp.EncryptWithPRNG([]byte("secret"), rand) })
+	assert.PanicsWithValue(t, ErrDestroyed, func() { qpp.DecryptWithPRNG([]byte("secret"), rand) })
+	assert.NotPanics(t, func() { qpp.Encrypt([]byte("secret")) })
+}
+
+func TestDestroySharedPads(t *testing.T) {
+	seed := []byte("shared seed")
+	cache := NewPadSetCache(2)
+	ps, err := cache.Get(seed, &Options{NumPads: 7})
+	assert.Nil(t, err)
+
+	// sessions and cached instances leave the shared pads to the cache
+	s := NewSession(ps, ps.CreatePRNG(seed), ps.CreatePRNG(seed))
+	s.Destroy()
+	qpp, err := New(seed, &Options{NumPads: 7, Cache: cache})
+	assert.Nil(t, err)
+	qpp.Destroy()
+	assert.NotEqual(t, make([]byte, len(ps.pads)), ps.pads, "shared pads zeroed")
+
+	other := NewSession(ps, ps.CreatePRNG(seed), ps.CreatePRNG(seed))
+	assert.NotPanics(t, func() { other.Encrypt([]byte("secret")) })
+
+	cache.Purge()
+	assert.PanicsWithValue(t, ErrDestroyed, func() { other.Encrypt([]byte("secret")) })
+}
+
+// failingKDF fails every call after the first n, PadSetCache may cache it
+type failingKDF struct {
+	KDF
+	n, calls int
+}
+
+func (k *failingKDF) Key(secret, salt []byte, keyLen int) ([]byte, error) {
+	k.calls++
+	if k.calls > k.n {
+		return nil, errors.New("kdf failed")
+	}
+	return k.KDF.Key(secret, salt, keyLen)
+}
+
+func (k *failingKDF) Fingerprint() []byte { return nil }
+
+func TestDestroyOnError(t *testing.T) {
+	seed := []byte("seed")
+	constructors := map[string]func(*Options) error{
+		"New": func(o *Options) error {
+			_, err := New(seed, o)
+			return err
+		},
+		"NewDuplex": func(o *Options) error {
+			_, err := NewDuplex(seed, ROLE_INITIATOR, o)
+			return err
+		},
+		"NewConfig": func(o *Options) error {
+			_, err := NewConfig(seed, o)
+			return err
+		},
+	}
+
+	// count the KDF calls of the pad set, then fail the first call after it
+	counter := &failingKDF{KDF: HKDF{}, n: 1 << 30}
+	_, err := NewPadSet(seed, &Options{NumPads: 3, KDF: counter})
+	assert.Nil(t, err)
+
+	for name, create := range constructors {
+		kdf := &failingKDF{KDF: HKDF{}, n: counter.calls}
+		opts := &Options{NumPads: 3, KDF: kdf, Cache: NewPadSetCache(2)}
+		assert.Error(t, create(opts), name)
+
+		// the pad set of the failed constructor was released to the cache
+		ps, err := opts.Cache.Get(seed, opts)
+		assert.Nil(t, err, name)
+		assert.Equal(t, 1, ps.holders, "%s leaked its pad set", name)
+	}
+}
+
+// recordingKDF records the keys it returns, so that tests can check they are scrubbed
+type recordingKDF struct {
+	KDF
+	keys [][]byte
+}
+
+func (k *recordingKDF) Key(secret, salt []byte, keyLen int) ([]byte, error) {
+	key, err := k.KDF.Key(secret, salt, keyLen)
+	k.keys = append(k.keys, key)
+	return key, err
+}
+
+// recordingBlock records the buffers it encrypts into
+type recordingBlock struct {
+	cipher.Block
+	dst [][]byte
+}
+
+func (b *recordingBlock) Encrypt(dst, src []byte) {
+	b.Block.Encrypt(dst, src)
+	b.dst = append(b.dst, dst)
+}
+
+func TestShuffleScrubs(t *testing.T) {
+	// the expanded short seed and every derived chunk key are wiped
+	kdf := &recordingKDF{KDF: HKDF{}}
+	d := newDerivation(kdf, nil, PRNG_XOSHIRO)
+	chunks, err := seedToChunks([]byte("short seed"), QUBITS, d)
+	assert.Nil(t, err)
+	assert.Len(t, kdf.keys, 1+len(chunks))
+	for i, key := range kdf.keys {
+		assert.Equal(t, make([]byte, len(key)), key, "key %d not wiped", i)
+	}
+	assert.NotEqual(t, make([]byte, 32), chunks[0], "chunks wiped")
+
+	// the HMAC sum shuffled through the block ciphers is wiped
+	block, err := aes.NewCipher(make([]byte, 32))
+	assert.Nil(t, err)
+	rec := &recordingBlock{Block: block}
+	pad := make([]byte, 1<<QUBITS)
+	fill(pad)
+	shuffle(chunks[0], pad, "pad", []cipher.Block{rec}, nil)
+	assert.NotEmpty(t, rec.dst)
+	for _, dst := range rec.dst {
+		assert.Equal(t, make([]byte, len(dst)), dst, "shuffle state not wiped")
+	}
+
+	s := newShakeStream([][]byte{[]byte("chunk")}, "id", nil)
+	s.uint32()
+	s.wipe()
+	assert.Equal(t, [512]byte{}, s.buf, "buffered output not wiped")
+}
@@ -0,0 +1,131 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+import "fmt"
+
+// Role is the side of a Duplex, the two peers of a connection must take opposite roles
+type Role int
+
+// Duplex roles and the direction labels separating their streams, both labels have
+// the same length so that the label and the context cannot be confused.
+const (
+	ROLE_INITIATOR Role = 1
+	ROLE_RESPONDER Role = 2
+
+	DIRECTION_INITIATOR_TO_RESPONDER = "___QUANTUM_PERMUTATION_PAD_INITIATOR_TO_RESPONDER___"
+	DIRECTION_RESPONDER_TO_INITIATOR = "___QUANTUM_PERMUTATION_PAD_RESPONDER_TO_INITIATOR___"
+)
+
+// Duplex encrypts the messages one peer sends and decrypts the messages it receives
+// Each direction has its own selector PRNG, and with Options.SeparatePads its own pad set,
+// derived from the seed and a direction label, so the two directions never share a keystream.
+// Like Session, a Duplex is not safe for concurrent use, but sending and receiving
+// only touch their own direction and may run in two goroutines.
+type Duplex struct {
+	send, recv         *PadSet
+	sendRand, recvRand *Rand
+}
+
+// NewDuplex creates the duplex of the given role from the seed shared by both peers
+func NewDuplex(seed []byte, role Role, opts *Options) (*Duplex, error) {
+	sendLabel, recvLabel := DIRECTION_INITIATOR_TO_RESPONDER, DIRECTION_RESPONDER_TO_INITIATOR
+	switch role {
+	case ROLE_INITIATOR:
+	case ROLE_RESPONDER:
+		sendLabel, recvLabel = recvLabel, sendLabel
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrInvalidRole, role)
+	}
+
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+
+	d := &Duplex{}
+	var err error
+	// a failure destroys the pad sets and PRNGs created so far
+	defer func() {
+		if err != nil {
+			d.Destroy()
+		}
+	}()
+	if o.SeparatePads {
+		if d.send, err = newDirectionPadSet(seed, o, sendLabel); err != nil {
+			return nil, err
+		}
+		if d.recv, err = newDirectionPadSet(seed, o, recvLabel); err != nil {
+			return nil, err
+		}
+	} else {
+		if d.send, err = NewPadSet(seed, &o); err != nil {
+			return nil, err
+		}
+		d.recv = d.send
+	}
+
+	if d.sendRand, err = createPRNG(seed, d.send.derive.withDirection(sendLabel, o.Context)); err != nil {
+		return nil, err
+	}
+	if d.recvRand, err = createPRNG(seed, d.recv.derive.withDirection(recvLabel, o.Context)); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// newDirectionPadSet derives the pad set of one direction
+func newDirectionPadSet(seed []byte, o Options, label string) (*PadSet, error) {
+	o.Context = append([]byte(label), o.Context...)
+	return NewPadSet(seed, &o)
+}
+
+// withDirection returns the derivation with the direction label prefixed to the context
+func (d derivation) withDirection(label string, context []byte) derivation {
+	d.context = append([]byte(label), context...)
+	return d
+}
+
+// Encrypt encrypts a message sent to the peer
+func (d *Duplex) Encrypt(data []byte) {
+	d.send.EncryptWithPRNG(data, d.sendRand)
+}
+
+// Decrypt decrypts a message received from the peer
+func (d *Duplex) Decrypt(data []byte) {
+	d.recv.DecryptWithPRNG(data, d.recvRand)
+}
+
+// Destroy wipes the PRNGs and the pads, pads from a PadSetCache are released as by PadSet.Destroy
+func (d *Duplex) Destroy() {
+	for _, r := range []*Rand{d.sendRand, d.recvRand} {
+		if r != nil {
+			r.Destroy()
+		}
+	}
+	if d.send != nil {
+		d.send.Destroy()
+	}
+	if d.recv != nil && d.recv != d.send {
+		d.recv.Destroy()
+	}
+}
+
+// Close destroys the key material of the duplex, it implements io.Closer and always returns nil
+func (d *Duplex) Close() error {
+	d.Destroy()
+	return nil
+}
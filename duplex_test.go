@@ -0,0 +1,69 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+import (
+	"crypto/rand"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDuplex(t *testing.T) {
+	seed := make([]byte, 32)
+	io.ReadFull(rand.Reader, seed)
+
+	for _, separate := range []bool{false, true} {
+		opts := &Options{NumPads: 977, SeparatePads: separate}
+		alice, err := NewDuplex(seed, ROLE_INITIATOR, opts)
+		assert.Nil(t, err)
+		bob, err := NewDuplex(seed, ROLE_RESPONDER, opts)
+		assert.Nil(t, err)
+		assert.Equal(t, separate, alice.send != alice.recv)
+
+		// both peers send the same plaintext, the directions must not share a keystream
+		original := make([]byte, 4096)
+		io.ReadFull(rand.Reader, original)
+		toBob := append([]byte(nil), original...)
+		toAlice := append([]byte(nil), original...)
+		encryptChunked(toBob, 100, 1, alice.Encrypt)
+		encryptChunked(toAlice, 77, 1, bob.Encrypt)
+		assert.NotEqual(t, toBob, toAlice, "directions share a keystream")
+
+		// the single-direction constructors must not collide with either direction
+		legacy := append([]byte(nil), original...)
+		qpp, err := New(seed, opts)
+		assert.Nil(t, err)
+		qpp.Encrypt(legacy)
+		assert.NotEqual(t, legacy, toBob)
+		assert.NotEqual(t, legacy, toAlice)
+
+		encryptChunked(toBob, 31, 1, bob.Decrypt)
+		encryptChunked(toAlice, 29, 1, alice.Decrypt)
+		assert.Equal(t, original, toBob, "not equal")
+		assert.Equal(t, original, toAlice, "not equal")
+
+		assert.Nil(t, alice.Close())
+		assert.PanicsWithValue(t, ErrDestroyed, func() { alice.Encrypt(original) })
+		assert.PanicsWithValue(t, ErrDestroyed, func() { alice.Decrypt(original) })
+	}
+
+	_, err := NewDuplex(seed, 0, &Options{NumPads: 977})
+	assert.ErrorIs(t, err, ErrInvalidRole)
+	_, err = NewDuplex(seed, ROLE_INITIATOR, &Options{})
+	assert.ErrorIs(t, err, ErrInvalidPadCount)
+}
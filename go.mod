@@ -5,6 +5,7 @@ go 1.22.3
 require (
 	github.com/stretchr/testify v1.9.0
 	golang.org/x/crypto v0.26.0
+	golang.org/x/sys v0.23.0
 )
 
 require (
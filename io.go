@@ -0,0 +1,274 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// IO_BUFFER_SIZE is the size of the pooled buffers of Writer and Reader
+const IO_BUFFER_SIZE = 32 * 1024
+
+// Errors returned by Writer and Reader
+var (
+	ErrClosed        = errors.New("qpp: use of closed reader or writer")
+	ErrPartialSymbol = errors.New("qpp: stream ends within a 16-qubit symbol")
+)
+
+// bufferPool holds the buffers of Writer and Reader, they are wiped before being returned
+var bufferPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, IO_BUFFER_SIZE)
+		return &b
+	},
+}
+
+// getBuffer takes a buffer from the pool for the duration of a call
+func getBuffer() *[]byte {
+	return bufferPool.Get().(*[]byte)
+}
+
+// putBuffer wipes the first n bytes of the buffer, the only ones used, and returns it to the pool
+func putBuffer(b *[]byte, n int) {
+	clear((*b)[:n])
+	bufferPool.Put(b)
+}
+
+// symbolStream holds what Writer and Reader share: the pads, the selector,
+// and the byte of a 16-qubit symbol split across calls.
+type symbolStream struct {
+	ps         *PadSet
+	sel        Selector
+	pending    byte // first byte of a split 16-qubit symbol
+	hasPending bool
+	closed     bool
+}
+
+// split returns the length of the whole symbols in b and keeps the byte after them as pending
+func (s *symbolStream) split(b []byte) int {
+	whole := len(b)
+	s.hasPending = false
+	if s.ps.qubits == 16 && whole%2 != 0 {
+		whole--
+		s.pending, s.hasPending = b[whole], true
+	}
+	return whole
+}
+
+// release wipes the pending byte and marks the stream closed
+func (s *symbolStream) release() {
+	s.pending, s.hasPending = 0, false
+	s.closed = true
+}
+
+// Writer encrypts everything written to it before passing it on
+// It is not safe for concurrent use.
+type Writer struct {
+	symbolStream
+	w   io.Writer
+	err error // sticky, the stream cannot resume after a failed write
+}
+
+// NewWriter returns a Writer encrypting with the pads and the selector into w
+func NewWriter(w io.Writer, ps *PadSet, sel Selector) *Writer {
+	return &Writer{symbolStream: symbolStream{ps: ps, sel: sel}, w: w}
+}
+
+// Write encrypts p and writes it to the underlying writer, p itself is left untouched
+func (w *Writer) Write(p []byte) (int, error) {
+	if err := w.check(); err != nil {
+		return 0, err
+	}
+	bp := getBuffer()
+	buf := *bp
+	defer putBuffer(bp, min(len(p)+1, len(buf)))
+
+	written := 0
+	for len(p) > 0 {
+		n := w.prefix(buf)
+		m := copy(buf[n:], p)
+		if err := w.flush(buf[:n+m]); err != nil {
+			return written, err
+		}
+		written += m
+		p = p[m:]
+	}
+	return written, nil
+}
+
+// ReadFrom encrypts everything read from r into the underlying writer, through a pooled buffer
+func (w *Writer) ReadFrom(r io.Reader) (int64, error) {
+	if err := w.check(); err != nil {
+		return 0, err
+	}
+	bp := getBuffer()
+	buf := *bp
+	defer putBuffer(bp, len(buf))
+
+	var total int64
+	for {
+		n := w.prefix(buf)
+		m, err := r.Read(buf[n:])
+		total += int64(m)
+		if ferr := w.flush(buf[:n+m]); ferr != nil {
+			return total, ferr
+		}
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+}
+
+// check returns the sticky error of the writer, ErrClosed once it is closed
+func (w *Writer) check() error {
+	if w.closed {
+		w.err = ErrClosed
+	}
+	return w.err
+}
+
+// prefix moves the pending byte, if any, to the start of buf and returns its length
+func (w *Writer) prefix(buf []byte) int {
+	if w.hasPending {
+		buf[0] = w.pending
+		return 1
+	}
+	return 0
+}
+
+// flush encrypts and writes the whole symbols of b, keeping a split symbol for later
+func (w *Writer) flush(b []byte) error {
+	whole := w.split(b)
+	if whole == 0 {
+		return nil
+	}
+	w.ps.EncryptWithSelector(b[:whole], w.sel)
+	if _, err := w.w.Write(b[:whole]); err != nil {
+		w.err = err
+		return err
+	}
+	return nil
+}
+
+// Close wipes the pending byte, and closes the underlying writer if it is an io.Closer
+// It returns ErrPartialSymbol if the data written ends within a 16-qubit symbol.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	partial := w.hasPending
+	w.release()
+	if c, ok := w.w.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			return err
+		}
+	}
+	if partial {
+		return ErrPartialSymbol
+	}
+	return nil
+}
+
+// Reader decrypts everything read from the underlying reader
+// Reads of any length keep the selector aligned, 16-qubit symbols split
+// across reads are held back until their second byte arrives.
+// It is not safe for concurrent use.
+type Reader struct {
+	symbolStream
+	r io.Reader
+}
+
+// NewReader returns a Reader decrypting with the pads and the selector from r
+func NewReader(r io.Reader, ps *PadSet, sel Selector) *Reader {
+	return &Reader{symbolStream: symbolStream{ps: ps, sel: sel}, r: r}
+}
+
+// Read reads and decrypts up to len(p) bytes into p
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.closed {
+		return 0, ErrClosed
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if r.ps.qubits == 16 && len(p) < 2 {
+		return 0, io.ErrShortBuffer
+	}
+
+	for {
+		n := 0
+		if r.hasPending {
+			p[0] = r.pending
+			n = 1
+		}
+		m, err := r.r.Read(p[n:])
+		whole := r.split(p[:n+m])
+		r.ps.DecryptWithSelector(p[:whole], r.sel)
+
+		if err == io.EOF && r.hasPending {
+			err = io.ErrUnexpectedEOF
+		}
+		// only a split symbol waiting for its second byte is worth another read
+		if whole > 0 || err != nil || !r.hasPending {
+			return whole, err
+		}
+	}
+}
+
+// WriteTo decrypts everything read from the underlying reader into w, through a pooled buffer
+func (r *Reader) WriteTo(w io.Writer) (int64, error) {
+	if r.closed {
+		return 0, ErrClosed
+	}
+	bp := getBuffer()
+	buf := *bp
+	defer putBuffer(bp, len(buf))
+
+	var total int64
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			m, werr := w.Write(buf[:n])
+			total += int64(m)
+			if werr != nil {
+				return total, werr
+			}
+		}
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+}
+
+// Close wipes the pending byte, and closes the underlying reader if it is an io.Closer
+func (r *Reader) Close() error {
+	if r.closed {
+		return nil
+	}
+	r.release()
+	if c, ok := r.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
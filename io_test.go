@@ -0,0 +1,151 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	mathrand "math/rand"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriterReader(t *testing.T) {
+	seed := make([]byte, 32)
+	io.ReadFull(rand.Reader, seed)
+
+	for _, opts := range []Options{
+		{NumPads: 977},
+		{NumPads: 31, Qubits: 4, PadSwitch: 5},
+		{NumPads: 3, Qubits: 16, PadSwitch: 7, KDF: HKDF{}},
+	} {
+		ps, err := NewPadSet(seed, &opts)
+		assert.Nil(t, err)
+
+		original := make([]byte, 100000)
+		io.ReadFull(rand.Reader, original)
+		expected := append([]byte(nil), original...)
+		ps.EncryptWithPRNG(expected, ps.CreatePRNG(seed))
+
+		// writes of any length, odd ones split 16-qubit symbols
+		var ciphertext bytes.Buffer
+		w := NewWriter(&ciphertext, ps, ps.CreatePRNG(seed))
+		src := append([]byte(nil), original...)
+		for len(src) > 0 {
+			n := min(len(src), mathrand.Intn(2*IO_BUFFER_SIZE)+1)
+			written, err := w.Write(src[:n])
+			assert.Nil(t, err)
+			assert.Equal(t, n, written)
+			src = src[n:]
+		}
+		assert.Equal(t, original, append([]byte(nil), original...), "source modified")
+		assert.Nil(t, w.Close())
+		assert.Equal(t, expected, ciphertext.Bytes(), "Writer differs from EncryptWithPRNG")
+
+		// ReadFrom fast path
+		ciphertext.Reset()
+		w = NewWriter(&ciphertext, ps, ps.CreatePRNG(seed))
+		n, err := io.Copy(w, iotest.HalfReader(bytes.NewReader(original)))
+		assert.Nil(t, err)
+		assert.Equal(t, int64(len(original)), n)
+		assert.Nil(t, w.Close())
+		assert.Equal(t, expected, ciphertext.Bytes(), "ReadFrom differs from EncryptWithPRNG")
+
+		// one byte at a time from the underlying reader
+		r := NewReader(iotest.OneByteReader(bytes.NewReader(expected)), ps, ps.CreatePRNG(seed))
+		plaintext, err := io.ReadAll(r)
+		assert.Nil(t, err)
+		assert.Equal(t, original, plaintext, "not equal")
+
+		// WriteTo fast path
+		var out bytes.Buffer
+		r = NewReader(iotest.HalfReader(bytes.NewReader(expected)), ps, ps.CreatePRNG(seed))
+		n, err = io.Copy(&out, r)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(len(original)), n)
+		assert.Equal(t, original, out.Bytes(), "not equal")
+		assert.Nil(t, r.Close())
+	}
+}
+
+// errWriter fails every write with err
+type errWriter struct{ err error }
+
+func (w errWriter) Write([]byte) (int, error) { return 0, w.err }
+
+func TestWriterClose(t *testing.T) {
+	ps, err := NewPadSet([]byte("seed"), &Options{NumPads: 7})
+	assert.Nil(t, err)
+
+	var out bytes.Buffer
+	w := NewWriter(&out, ps, FastPRNG([]byte("seed")))
+	w.Write([]byte("secret"))
+	assert.Nil(t, w.Close())
+	_, err = w.Write([]byte("more"))
+	assert.ErrorIs(t, err, ErrClosed)
+	assert.Nil(t, w.Close())
+
+	// a failed write is sticky, the stream cannot be resumed
+	broken := errors.New("broken")
+	w = NewWriter(errWriter{broken}, ps, FastPRNG([]byte("seed")))
+	_, err = w.Write([]byte("secret"))
+	assert.ErrorIs(t, err, broken)
+	_, err = w.Write([]byte("secret"))
+	assert.ErrorIs(t, err, broken)
+}
+
+func TestBufferWiped(t *testing.T) {
+	// the used part of a pooled buffer is wiped before it goes back to the pool
+	bp := getBuffer()
+	copy(*bp, "secret")
+	putBuffer(bp, len("secret"))
+	assert.Equal(t, make([]byte, len("secret")), (*bp)[:len("secret")], "buffer not wiped")
+}
+
+func TestPartialSymbol(t *testing.T) {
+	ps, err := NewPadSet([]byte("seed"), &Options{NumPads: 3, Qubits: 16, KDF: HKDF{}})
+	assert.Nil(t, err)
+
+	var out bytes.Buffer
+	w := NewWriter(&out, ps, FastPRNG([]byte("seed")))
+	n, err := w.Write([]byte("odd"))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, 2, out.Len(), "split symbol written")
+	assert.ErrorIs(t, w.Close(), ErrPartialSymbol)
+
+	r := NewReader(bytes.NewReader([]byte("odd")), ps, FastPRNG([]byte("seed")))
+	_, err = io.ReadAll(r)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	r = NewReader(bytes.NewReader([]byte("even")), ps, FastPRNG([]byte("seed")))
+	_, err = r.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.ErrShortBuffer)
+}
+
+func BenchmarkWriter(b *testing.B) {
+	ps, _ := NewPadSet([]byte("seed"), &Options{NumPads: 977})
+	w := NewWriter(io.Discard, ps, FastPRNG([]byte("seed")))
+	msg := make([]byte, 65536)
+	b.SetBytes(int64(len(msg)))
+	for i := 0; i < b.N; i++ {
+		w.Write(msg)
+	}
+}
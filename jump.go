@@ -0,0 +1,90 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+import "errors"
+
+// ErrNotJumpable is the panic value of jumping a Rand that is not backed by xoshiro256**
+var ErrNotJumpable = errors.New("qpp: only xoshiro256** PRNGs can jump")
+
+// Jump polynomials of xoshiro256**, from the reference implementation by Blackman and Vigna
+var (
+	xoshiroJump     = [4]uint64{0x180ec6d33cfd0aba, 0xd5a61266f0c9392c, 0xa9582618e03fc9aa, 0x39abdc4529b1661c}
+	xoshiroLongJump = [4]uint64{0x76e15d3efefdcbbf, 0xc5004e441c522fb3, 0x77710069854ee241, 0x39109bb02acbe635}
+)
+
+// Jump advances the PRNG by 2^128 words and starts a fresh word, it can be used
+// to generate 2^128 non-overlapping substreams for parallel computations.
+func (r *Rand) Jump() {
+	r.jump(&xoshiroJump)
+}
+
+// LongJump advances the PRNG by 2^192 words and starts a fresh word, it can be used
+// to generate 2^64 starting points, from each of which Jump generates 2^64 substreams.
+func (r *Rand) LongJump() {
+	r.jump(&xoshiroLongJump)
+}
+
+// Split returns n PRNGs on non-overlapping substreams of r, 2^128 words apart
+// The i-th PRNG starts i jumps ahead of the current state and r itself is moved
+// n jumps ahead, so r and every substream can be used independently.
+func (r *Rand) Split(n int) []*Rand {
+	r.checkJumpable()
+	subs := make([]*Rand, n)
+	for i := range subs {
+		sub := &Rand{xoshiro: r.xoshiro, origin: r.xoshiro}
+		sub.seed64 = sub.next()
+		subs[i] = sub
+		r.Jump()
+	}
+	return subs
+}
+
+// jump moves the state by the polynomial and starts a fresh word
+func (r *Rand) jump(poly *[4]uint64) {
+	r.checkJumpable()
+	xoshiroJumpState(&r.xoshiro, poly)
+	r.origin = r.xoshiro
+	r.seed64 = r.next()
+	r.count = 0
+}
+
+// xoshiroJumpState replaces the state with the state after the number of words encoded by the polynomial
+func xoshiroJumpState(state *[4]uint64, poly *[4]uint64) {
+	var s [4]uint64
+	for _, word := range poly {
+		for b := 0; b < 64; b++ {
+			if word&(1<<b) != 0 {
+				s[0] ^= state[0]
+				s[1] ^= state[1]
+				s[2] ^= state[2]
+				s[3] ^= state[3]
+			}
+			xoshiro256ss(state)
+		}
+	}
+	*state = s
+}
+
+// checkJumpable panics unless r is a live xoshiro256** PRNG
+func (r *Rand) checkJumpable() {
+	if r.destroyed {
+		panic(ErrDestroyed)
+	}
+	if r.keystream != nil {
+		panic(ErrNotJumpable)
+	}
+}
@@ -0,0 +1,75 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+import (
+	"crypto/rand"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJump(t *testing.T) {
+	// expected states from the reference implementation of xoshiro256**
+	s := [4]uint64{1, 2, 3, 4}
+	xoshiroJumpState(&s, &xoshiroJump)
+	assert.Equal(t, [4]uint64{0x8c7a153956b5f3d1, 0x701f1a713401d85e, 0x6527f66a65469085, 0x8386b786c4408050}, s)
+
+	s = [4]uint64{1, 2, 3, 4}
+	xoshiroJumpState(&s, &xoshiroLongJump)
+	assert.Equal(t, [4]uint64{0x096a8eb71295a400, 0xdbf84991e50f4516, 0x534ee745810d2a0e, 0x31655ca1a2215bf1}, s)
+
+	// the Rand starts a fresh word from the jumped state
+	r := &Rand{xoshiro: [4]uint64{1, 2, 3, 4}, count: 5}
+	r.Jump()
+	s = [4]uint64{1, 2, 3, 4}
+	xoshiroJumpState(&s, &xoshiroJump)
+	assert.Equal(t, xoshiro256ss(&s), r.seed64)
+	assert.Equal(t, s, r.xoshiro)
+	assert.Equal(t, uint8(0), r.count)
+}
+
+func TestSplit(t *testing.T) {
+	seed := make([]byte, 32)
+	io.ReadFull(rand.Reader, seed)
+	qpp := NewQPP(seed, 977)
+
+	r := CreatePRNG(seed)
+	subs := r.Split(4)
+	assert.Len(t, subs, 4)
+
+	// substreams are reproducible from the same seed and distinct from each other and from r
+	again := CreatePRNG(seed).Split(4)
+	seen := map[uint64]bool{r.seed64: true}
+	for i, sub := range subs {
+		assert.Equal(t, *again[i], *sub)
+		assert.False(t, seen[sub.seed64], "substream %d overlaps", i)
+		seen[sub.seed64] = true
+	}
+
+	// each substream encrypts and decrypts on its own
+	for i, sub := range subs {
+		msg := make([]byte, 1000)
+		io.ReadFull(rand.Reader, msg)
+		original := append([]byte(nil), msg...)
+		qpp.EncryptWithPRNG(msg, sub)
+		qpp.DecryptWithPRNG(msg, again[i])
+		assert.Equal(t, original, msg, "not equal")
+	}
+
+	assert.PanicsWithValue(t, ErrNotJumpable, func() { FastPRNGWith(seed, PRNG_CHACHA20).Jump() })
+}
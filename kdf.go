@@ -0,0 +1,176 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Default cost parameters of the built-in key derivation functions
+const (
+	SCRYPT_N       = 1 << 15   // CPU/memory cost of scrypt
+	SCRYPT_R       = 8         // Block size of scrypt
+	SCRYPT_P       = 1         // Parallelization of scrypt
+	ARGON2_TIME    = 1         // Number of passes of Argon2id
+	ARGON2_MEMORY  = 64 * 1024 // Memory of Argon2id in KiB
+	ARGON2_THREADS = 4         // Number of lanes of Argon2id
+)
+
+// ErrInvalidKDF is returned when a key derivation function is misconfigured
+var ErrInvalidKDF = errors.New("qpp: invalid key derivation function")
+
+// KDF derives keyLen bytes of key material from a secret and a salt
+// It is used to expand the seed into chunks and to derive the key of the PRNG,
+// a slow KDF such as Argon2id or scrypt protects seeds taken from human passphrases.
+type KDF interface {
+	Key(secret, salt []byte, keyLen int) ([]byte, error)
+}
+
+// PBKDF2 derives keys with PBKDF2
+type PBKDF2 struct {
+	Iterations int              // Number of iterations, defaults to PBKDF2_LOOPS
+	Hash       func() hash.Hash // Hash function for HMAC, defaults to SHA-1
+}
+
+// Key implements KDF
+func (k PBKDF2) Key(secret, salt []byte, keyLen int) ([]byte, error) {
+	iter := k.Iterations
+	if iter == 0 {
+		iter = PBKDF2_LOOPS
+	}
+	if iter < 0 {
+		return nil, fmt.Errorf("%w: PBKDF2 iterations %d", ErrInvalidKDF, iter)
+	}
+
+	h := k.Hash
+	if h == nil {
+		h = sha1.New
+	}
+	return pbkdf2.Key(secret, salt, iter, keyLen, h), nil
+}
+
+// HKDF derives keys with HKDF, it is fast and only suitable for high-entropy seeds
+type HKDF struct {
+	Hash func() hash.Hash // Hash function, defaults to SHA-256
+}
+
+// Key implements KDF
+func (k HKDF) Key(secret, salt []byte, keyLen int) ([]byte, error) {
+	h := k.Hash
+	if h == nil {
+		h = sha256.New
+	}
+
+	key := make([]byte, keyLen)
+	if _, err := io.ReadFull(hkdf.New(h, secret, salt, nil), key); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKDF, err)
+	}
+	return key, nil
+}
+
+// Scrypt derives keys with scrypt
+type Scrypt struct {
+	N int // CPU/memory cost, a power of 2, defaults to SCRYPT_N
+	R int // Block size, defaults to SCRYPT_R
+	P int // Parallelization, defaults to SCRYPT_P
+}
+
+// Key implements KDF
+func (k Scrypt) Key(secret, salt []byte, keyLen int) ([]byte, error) {
+	n, r, p := k.N, k.R, k.P
+	if n == 0 {
+		n = SCRYPT_N
+	}
+	if r == 0 {
+		r = SCRYPT_R
+	}
+	if p == 0 {
+		p = SCRYPT_P
+	}
+
+	key, err := scrypt.Key(secret, salt, n, r, p, keyLen)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKDF, err)
+	}
+	return key, nil
+}
+
+// Argon2id derives keys with Argon2id
+type Argon2id struct {
+	Time    uint32 // Number of passes, defaults to ARGON2_TIME
+	Memory  uint32 // Memory in KiB, defaults to ARGON2_MEMORY
+	Threads uint8  // Number of lanes, defaults to ARGON2_THREADS
+}
+
+// Key implements KDF
+func (k Argon2id) Key(secret, salt []byte, keyLen int) ([]byte, error) {
+	time, memory, threads := k.Time, k.Memory, k.Threads
+	if time == 0 {
+		time = ARGON2_TIME
+	}
+	if memory == 0 {
+		memory = ARGON2_MEMORY
+	}
+	if threads == 0 {
+		threads = ARGON2_THREADS
+	}
+	return argon2.IDKey(secret, salt, time, memory, threads, uint32(keyLen)), nil
+}
+
+// derivation holds the key derivation functions and the domain-separation context used to derive pads and PRNGs
+type derivation struct {
+	light   KDF    // expands short seeds and derives the PRNG key
+	heavy   KDF    // expands each seed chunk
+	context []byte // domain-separation label appended to every salt and identifier
+	prng    int    // selector PRNG algorithm
+}
+
+// v1Derivation is the original PBKDF2-HMAC-SHA1 profile, it must never change
+// so that existing seeds keep producing the same pads and PRNGs.
+var v1Derivation = derivation{
+	light: PBKDF2{Iterations: PBKDF2_LOOPS, Hash: sha1.New},
+	heavy: PBKDF2{Iterations: CHUNK_DERIVE_LOOPS, Hash: sha1.New},
+	prng:  PRNG_XOSHIRO,
+}
+
+// newDerivation returns the derivation for the given KDF, context and PRNG algorithm, a nil KDF selects the v1 profile
+func newDerivation(kdf KDF, context []byte, prng int) derivation {
+	d := v1Derivation
+	d.prng = prng
+	if kdf != nil {
+		d.light, d.heavy = kdf, kdf
+	}
+	if len(context) > 0 {
+		d.context = append([]byte(nil), context...)
+	}
+	return d
+}
+
+// label appends the context to a salt or identifier, the constants have fixed
+// lengths so the concatenation is unambiguous, and an empty context leaves it unchanged.
+func (d derivation) label(base string) []byte {
+	return append([]byte(base), d.context...)
+}
@@ -0,0 +1,109 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// cheap cost parameters to keep the tests fast
+var testKDFs = map[string]KDF{
+	"pbkdf2":   PBKDF2{Iterations: 16},
+	"hkdf":     HKDF{},
+	"scrypt":   Scrypt{N: 1024},
+	"argon2id": Argon2id{Memory: 1024, Threads: 1},
+}
+
+func TestKDFDeterministic(t *testing.T) {
+	for name, kdf := range testKDFs {
+		k1, err := kdf.Key([]byte("passphrase"), []byte("salt"), 32)
+		assert.Nil(t, err, name)
+		k2, err := kdf.Key([]byte("passphrase"), []byte("salt"), 32)
+		assert.Nil(t, err, name)
+		k3, err := kdf.Key([]byte("passphrase"), []byte("pepper"), 32)
+		assert.Nil(t, err, name)
+
+		assert.Equal(t, 32, len(k1), name)
+		assert.Equal(t, k1, k2, "%s: not deterministic", name)
+		assert.NotEqual(t, k1, k3, "%s: salt ignored", name)
+	}
+}
+
+func TestKDFInvalidParameters(t *testing.T) {
+	_, err := Scrypt{N: 1000}.Key([]byte("passphrase"), []byte("salt"), 32)
+	assert.True(t, errors.Is(err, ErrInvalidKDF), "unexpected error %v", err)
+
+	_, err = PBKDF2{Iterations: -1}.Key([]byte("passphrase"), []byte("salt"), 32)
+	assert.True(t, errors.Is(err, ErrInvalidKDF), "unexpected error %v", err)
+
+	qpp, err := New([]byte("passphrase"), &Options{NumPads: 7, KDF: Scrypt{N: 1000}})
+	assert.Nil(t, qpp)
+	assert.True(t, errors.Is(err, ErrInvalidKDF), "unexpected error %v", err)
+}
+
+func TestKDFDefaultProfile(t *testing.T) {
+	seed := make([]byte, 32)
+	io.ReadFull(rand.Reader, seed)
+
+	// the v1 profile must keep producing the pads and PRNG of NewQPP/CreatePRNG
+	qpp, err := New(seed, &Options{NumPads: 7, KDF: nil})
+	assert.Nil(t, err)
+	legacy := NewQPP(seed, 7)
+	assert.Equal(t, legacy.pads, qpp.pads)
+	assert.Equal(t, CreatePRNG(seed), qpp.CreatePRNG(seed))
+}
+
+func TestKDFEncryption(t *testing.T) {
+	seed := []byte("correct horse battery staple")
+	legacy := NewQPP(seed, 7)
+
+	for name, kdf := range testKDFs {
+		sender, err := New(seed, &Options{NumPads: 7, KDF: kdf})
+		assert.Nil(t, err, name)
+		receiver, err := New(seed, &Options{NumPads: 7, KDF: kdf})
+		assert.Nil(t, err, name)
+		assert.NotEqual(t, legacy.pads, sender.pads, "%s: same pads as v1", name)
+
+		original := make([]byte, 4096)
+		io.ReadFull(rand.Reader, original)
+		msg := make([]byte, len(original))
+		copy(msg, original)
+
+		sender.Encrypt(msg)
+		assert.NotEqual(t, original, msg, "%s: not encrypted", name)
+		receiver.Decrypt(msg)
+		assert.Equal(t, original, msg, "%s: not equal", name)
+	}
+}
+
+func BenchmarkKDFArgon2id(b *testing.B) {
+	seed := []byte("correct horse battery staple")
+	for i := 0; i < b.N; i++ {
+		_, _ = Argon2id{}.Key(seed, []byte(CHUNK_DERIVE_SALT), 32)
+	}
+}
+
+func BenchmarkKDFScrypt(b *testing.B) {
+	seed := []byte("correct horse battery staple")
+	for i := 0; i < b.N; i++ {
+		_, _ = Scrypt{}.Key(seed, []byte(CHUNK_DERIVE_SALT), 32)
+	}
+}
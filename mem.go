@@ -0,0 +1,89 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+import (
+	"runtime"
+	"unsafe"
+)
+
+// lockedBuffer is a table allocated outside of the Go heap, locked against
+// swapping, excluded from core dumps and surrounded by inaccessible guard pages.
+type lockedBuffer struct {
+	region []byte // whole mapping including the guard pages
+	data   []byte // usable bytes between the guard pages
+}
+
+// allocTables allocates pads and rpads for n symbols each, in locked memory if lock is
+// set and the platform allows it, and on the Go heap otherwise.
+// 4- and 8-qubit pads hold one symbol per byte, 16-qubit pads one symbol per uint16.
+func (ps *PadSet) allocTables(n int, lock bool) {
+	size := n
+	if ps.qubits == 16 {
+		size = 2 * n
+	}
+
+	if lock {
+		if pads, err := allocLocked(size); err == nil {
+			if rpads, err := allocLocked(size); err == nil {
+				ps.mem = []*lockedBuffer{pads, rpads}
+				ps.pads, ps.rpads = pads.data, rpads.data
+				// the mappings are not tracked by the garbage collector
+				runtime.SetFinalizer(ps, (*PadSet).wipe)
+			} else {
+				pads.free()
+			}
+		}
+	}
+
+	if ps.mem == nil {
+		if ps.qubits == 16 {
+			// allocate uint16 tables on the heap to get their alignment
+			pads16, rpads16 := make([]uint16, n), make([]uint16, n)
+			ps.pads = unsafe.Slice((*byte)(unsafe.Pointer(unsafe.SliceData(pads16))), size)
+			ps.rpads = unsafe.Slice((*byte)(unsafe.Pointer(unsafe.SliceData(rpads16))), size)
+		} else {
+			ps.pads = make([]byte, size)
+			ps.rpads = make([]byte, size)
+		}
+	}
+
+	if ps.qubits == 16 {
+		ps.pads16 = unsafe.Slice((*uint16)(unsafe.Pointer(unsafe.SliceData(ps.pads))), n)
+		ps.rpads16 = unsafe.Slice((*uint16)(unsafe.Pointer(unsafe.SliceData(ps.rpads))), n)
+	}
+	ps.padsPtr = unsafe.Pointer(unsafe.SliceData(ps.pads))
+	ps.rpadsPtr = unsafe.Pointer(unsafe.SliceData(ps.rpads))
+}
+
+// freeTables releases locked tables, the pad set must not be used afterwards
+func (ps *PadSet) freeTables() {
+	if ps.mem == nil {
+		return
+	}
+	for _, b := range ps.mem {
+		b.free()
+	}
+	ps.mem = nil
+	ps.pads, ps.rpads, ps.pads16, ps.rpads16 = nil, nil, nil, nil
+	ps.padsPtr, ps.rpadsPtr = nil, nil
+	runtime.SetFinalizer(ps, nil)
+}
+
+// Locked reports whether the pads live in locked, non-dumpable memory
+func (ps *PadSet) Locked() bool {
+	return ps.mem != nil
+}
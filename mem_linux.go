@@ -0,0 +1,60 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+//go:build linux
+
+package qpp
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// mlock locks a mapping into RAM, replaced in tests to simulate a low RLIMIT_MEMLOCK
+var mlock = unix.Mlock
+
+// allocLocked maps size bytes between two guard pages, locks them into RAM
+// and excludes them from core dumps.
+func allocLocked(size int) (*lockedBuffer, error) {
+	page := os.Getpagesize()
+	n := (size + page - 1) / page * page
+	region, err := unix.Mmap(-1, 0, n+2*page, unix.PROT_NONE, unix.MAP_PRIVATE|unix.MAP_ANON)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &lockedBuffer{region: region, data: region[page : page+n]}
+	if err := unix.Mprotect(b.data, unix.PROT_READ|unix.PROT_WRITE); err != nil {
+		b.free()
+		return nil, err
+	}
+	if err := unix.Madvise(b.data, unix.MADV_DONTDUMP); err != nil {
+		b.free()
+		return nil, err
+	}
+	// fails with ENOMEM or EPERM when RLIMIT_MEMLOCK is too low
+	if err := mlock(b.data); err != nil {
+		b.free()
+		return nil, err
+	}
+	b.data = b.data[:size]
+	return b, nil
+}
+
+// free unmaps the buffer, which also unlocks it
+func (b *lockedBuffer) free() {
+	unix.Munmap(b.region)
+}
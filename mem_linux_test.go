@@ -0,0 +1,48 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestLockMemoryGuardPages(t *testing.T) {
+	b, err := allocLocked(1000)
+	assert.Nil(t, err)
+	defer b.free()
+
+	page := os.Getpagesize()
+	assert.Equal(t, 1000, len(b.data))
+	assert.Equal(t, 3*page, len(b.region), "missing guard pages")
+	assert.True(t, &b.region[page] == &b.data[0], "data does not start after the leading guard page")
+}
+
+func TestLockMemoryFallback(t *testing.T) {
+	// simulate RLIMIT_MEMLOCK being exhausted
+	mlock = func([]byte) error { return unix.ENOMEM }
+	defer func() { mlock = unix.Mlock }()
+
+	qpp, err := New([]byte("seed"), &Options{NumPads: 7, LockMemory: true})
+	assert.Nil(t, err)
+	assert.False(t, qpp.Locked(), "pads locked despite mlock failure")
+
+	expected := NewQPP([]byte("seed"), 7)
+	assert.Equal(t, expected.pads, qpp.pads)
+}
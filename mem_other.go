@@ -0,0 +1,28 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+//go:build !linux
+
+package qpp
+
+import "errors"
+
+// allocLocked is only supported on Linux, other platforms keep the pads on the heap
+func allocLocked(size int) (*lockedBuffer, error) {
+	return nil, errors.ErrUnsupported
+}
+
+// free is never called since allocLocked always fails
+func (b *lockedBuffer) free() {}
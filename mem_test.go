@@ -0,0 +1,64 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+import (
+	"crypto/rand"
+	"io"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockMemory(t *testing.T) {
+	seed := make([]byte, 32)
+	io.ReadFull(rand.Reader, seed)
+
+	for _, opts := range []Options{
+		{NumPads: 7},
+		{NumPads: 7, Qubits: 4},
+		{NumPads: 3, Qubits: 16, KDF: HKDF{}},
+	} {
+		heap, err := New(seed, &opts)
+		assert.Nil(t, err)
+		assert.False(t, heap.Locked())
+
+		opts.LockMemory = true
+		locked, err := New(seed, &opts)
+		assert.Nil(t, err)
+		if runtime.GOOS == "linux" {
+			assert.True(t, locked.Locked(), "pads not locked")
+		}
+		assert.Equal(t, heap.pads, locked.pads, "locked pads differ")
+		assert.Equal(t, heap.rpads, locked.rpads, "locked rpads differ")
+		assert.Equal(t, heap.pads16, locked.pads16, "locked 16-qubit pads differ")
+
+		msg := make([]byte, 4096)
+		io.ReadFull(rand.Reader, msg)
+		expected := append([]byte(nil), msg...)
+		heap.Encrypt(expected)
+		locked.Encrypt(msg)
+		assert.Equal(t, expected, msg, "ciphertexts differ")
+		locked.Decrypt(msg)
+		heap.Decrypt(expected)
+		assert.Equal(t, expected, msg)
+
+		locked.Destroy()
+		assert.False(t, locked.Locked())
+		assert.PanicsWithValue(t, ErrDestroyed, func() { locked.Encrypt(msg) })
+	}
+}
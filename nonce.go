@@ -0,0 +1,205 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Per-message PRNG derivation
+const (
+	NONCE_SIZE            = 16 // size of the nonce of a per-message PRNG
+	PRNG_NONCE_IDENTIFIER = "___QUANTUM_PERMUTATION_PAD_PRNG_NONCE___"
+)
+
+// Errors returned when deriving per-message PRNGs
+var (
+	ErrInvalidNonce = errors.New("qpp: invalid nonce")
+	ErrNonceReused  = errors.New("qpp: nonce reused")
+)
+
+// PRNGKey derives a PRNG per message from a nonce
+// The expensive HMAC and KDF step runs once in NewPRNGKey, every nonce then
+// costs a single HMAC-SHA256, so each message gets its own selector stream.
+type PRNGKey struct {
+	key  []byte // 32-byte key derived from the seed
+	prng int    // PRNG algorithm
+}
+
+// NewPRNGKey derives the per-message PRNG key of the seed with the v1 profile of CreatePRNG
+func NewPRNGKey(seed []byte) (*PRNGKey, error) {
+	return newPRNGKey(seed, v1Derivation)
+}
+
+// NewPRNGKey derives the per-message PRNG key of the seed, using the key derivation
+// function, context and PRNG algorithm this pad set was created with.
+func (ps *PadSet) NewPRNGKey(seed []byte) (*PRNGKey, error) {
+	return newPRNGKey(seed, ps.derive)
+}
+
+// newPRNGKey derives the PRNG key of the seed for the derivation
+func newPRNGKey(seed []byte, d derivation) (*PRNGKey, error) {
+	key, err := derivePRNGKey(seed, d)
+	if err != nil {
+		return nil, err
+	}
+	return &PRNGKey{key: key, prng: d.prng}, nil
+}
+
+// PRNG creates the PRNG of the message identified by nonce, which must be NONCE_SIZE
+// bytes long and never be used twice with the same key.
+func (k *PRNGKey) PRNG(nonce []byte) (*Rand, error) {
+	if k.key == nil {
+		return nil, ErrDestroyed
+	}
+	if len(nonce) != NONCE_SIZE {
+		return nil, fmt.Errorf("%w: length %d, must be %d", ErrInvalidNonce, len(nonce), NONCE_SIZE)
+	}
+
+	mac := hmac.New(sha256.New, k.key)
+	mac.Write([]byte(PRNG_NONCE_IDENTIFIER))
+	mac.Write(nonce)
+	sum := mac.Sum(nil)
+	defer clear(sum)
+	return newRand(sum, k.prng)
+}
+
+// Destroy overwrites the key with zeros, later calls to PRNG return ErrDestroyed
+func (k *PRNGKey) Destroy() {
+	clear(k.key)
+	k.key = nil
+}
+
+// CreatePRNGWithNonce creates the PRNG of the message identified by nonce
+// The expensive HMAC and PBKDF2 step runs once per seed: the keys of the last
+// DEFAULT_CACHE_SIZE seeds are kept, keyed by an HMAC of the seed under a random
+// process key, so later messages of a seed only cost the HMAC of PRNGKey.PRNG.
+func CreatePRNGWithNonce(seed, nonce []byte) (*Rand, error) {
+	return prngKeys.prng(seed, nonce)
+}
+
+// prngKeys memoizes the keys derived by CreatePRNGWithNonce
+var prngKeys = newPRNGKeyCache(DEFAULT_CACHE_SIZE)
+
+// prngKeyCache keeps the PRNG keys of recent seeds, evicted keys are destroyed
+type prngKeyCache struct {
+	mu       sync.Mutex
+	key      [32]byte                   // random key for fingerprints
+	capacity int                        // maximum number of keys
+	lru      *list.List                 // keys, most recently used at front
+	entries  map[[32]byte]*list.Element // fingerprint -> element of lru
+}
+
+// prngKeyEntry is an element of the LRU list
+type prngKeyEntry struct {
+	fingerprint [32]byte
+	key         *PRNGKey
+}
+
+// newPRNGKeyCache creates a cache holding at most capacity keys
+func newPRNGKeyCache(capacity int) *prngKeyCache {
+	c := &prngKeyCache{
+		capacity: capacity,
+		lru:      list.New(),
+		entries:  make(map[[32]byte]*list.Element),
+	}
+	if _, err := io.ReadFull(rand.Reader, c.key[:]); err != nil {
+		panic(fmt.Sprintf("newPRNGKeyCache: failed to generate fingerprint key: %v", err))
+	}
+	return c
+}
+
+// prng creates the PRNG of the nonce with the key of the seed, deriving the key on a miss
+// The key is only used under the lock, as eviction destroys it.
+func (c *prngKeyCache) prng(seed, nonce []byte) (*Rand, error) {
+	mac := hmac.New(sha256.New, c.key[:])
+	mac.Write(seed)
+	var fp [32]byte
+	mac.Sum(fp[:0])
+
+	c.mu.Lock()
+	if e, ok := c.entries[fp]; ok {
+		c.lru.MoveToFront(e)
+		defer c.mu.Unlock()
+		return e.Value.(*prngKeyEntry).key.PRNG(nonce)
+	}
+	c.mu.Unlock()
+
+	// derive outside of the lock so that a slow derivation does not block other seeds
+	k, err := NewPRNGKey(seed)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// another goroutine may have derived the same key meanwhile, keep the first one
+	if e, ok := c.entries[fp]; ok {
+		c.lru.MoveToFront(e)
+		k.Destroy()
+		return e.Value.(*prngKeyEntry).key.PRNG(nonce)
+	}
+
+	c.entries[fp] = c.lru.PushFront(&prngKeyEntry{fingerprint: fp, key: k})
+	for c.lru.Len() > c.capacity {
+		e := c.lru.Back()
+		c.lru.Remove(e)
+		delete(c.entries, e.Value.(*prngKeyEntry).fingerprint)
+		e.Value.(*prngKeyEntry).key.Destroy()
+	}
+	return k.PRNG(nonce)
+}
+
+// CounterNonce returns the nonce of a message counter, encoded big-endian so that
+// nonces of increasing counters compare in increasing byte order.
+func CounterNonce(counter uint64) []byte {
+	nonce := make([]byte, NONCE_SIZE)
+	binary.BigEndian.PutUint64(nonce[NONCE_SIZE-8:], counter)
+	return nonce
+}
+
+// NonceChecker rejects nonces that do not strictly increase, which catches the
+// reuse of counter nonces, e.g. after a counter was reset, in constant memory.
+// It is safe for concurrent use.
+type NonceChecker struct {
+	mu   sync.Mutex
+	last []byte // largest nonce accepted so far, nil before the first
+}
+
+// Check accepts nonce if it is larger than every nonce accepted before,
+// and returns ErrNonceReused otherwise.
+func (c *NonceChecker) Check(nonce []byte) error {
+	if len(nonce) != NONCE_SIZE {
+		return fmt.Errorf("%w: length %d, must be %d", ErrInvalidNonce, len(nonce), NONCE_SIZE)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.last != nil && bytes.Compare(nonce, c.last) <= 0 {
+		return fmt.Errorf("%w: %x is not larger than %x", ErrNonceReused, nonce, c.last)
+	}
+	c.last = append(c.last[:0], nonce...)
+	return nil
+}
@@ -0,0 +1,133 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+import (
+	"crypto/rand"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPRNGWithNonce(t *testing.T) {
+	seed := make([]byte, 32)
+	io.ReadFull(rand.Reader, seed)
+	qpp := NewQPP(seed, 977)
+
+	key, err := NewPRNGKey(seed)
+	assert.Nil(t, err)
+
+	// every nonce gets its own stream, reproducible from the seed alone
+	streams := map[uint64]bool{CreatePRNG(seed).seed64: true}
+	for i := range uint64(100) {
+		r, err := key.PRNG(CounterNonce(i))
+		assert.Nil(t, err)
+		assert.False(t, streams[r.seed64], "stream of nonce %d reused", i)
+		streams[r.seed64] = true
+
+		again, err := CreatePRNGWithNonce(seed, CounterNonce(i))
+		assert.Nil(t, err)
+		assert.Equal(t, *r, *again)
+	}
+
+	// messages encrypt and decrypt with the PRNGs of their nonces
+	msg := make([]byte, 1000)
+	io.ReadFull(rand.Reader, msg)
+	original := append([]byte(nil), msg...)
+	enc, _ := key.PRNG(CounterNonce(7))
+	dec, _ := CreatePRNGWithNonce(seed, CounterNonce(7))
+	qpp.EncryptWithPRNG(msg, enc)
+	qpp.DecryptWithPRNG(msg, dec)
+	assert.Equal(t, original, msg, "not equal")
+
+	// the pad set derivation and PRNG algorithm apply to its keys
+	ps, err := NewPadSet(seed, &Options{NumPads: 7, Context: []byte("tenant"), PRNG: PRNG_CHACHA20})
+	assert.Nil(t, err)
+	psKey, err := ps.NewPRNGKey(seed)
+	assert.Nil(t, err)
+	r, err := psKey.PRNG(CounterNonce(0))
+	assert.Nil(t, err)
+	assert.NotNil(t, r.keystream)
+	assert.False(t, streams[r.seed64])
+
+	_, err = key.PRNG(make([]byte, NONCE_SIZE-1))
+	assert.ErrorIs(t, err, ErrInvalidNonce)
+	key.Destroy()
+	_, err = key.PRNG(CounterNonce(0))
+	assert.ErrorIs(t, err, ErrDestroyed)
+}
+
+func TestPRNGKeyCache(t *testing.T) {
+	c := newPRNGKeyCache(2)
+	seeds := [][]byte{[]byte("seed-a"), []byte("seed-b"), []byte("seed-c")}
+
+	// the key of a seed is derived once and gives the streams of NewPRNGKey
+	r, err := c.prng(seeds[0], CounterNonce(1))
+	assert.Nil(t, err)
+	keyA := c.lru.Front().Value.(*prngKeyEntry).key
+	again, err := c.prng(seeds[0], CounterNonce(1))
+	assert.Nil(t, err)
+	assert.Equal(t, *r, *again)
+	assert.True(t, keyA == c.lru.Front().Value.(*prngKeyEntry).key, "key derived again")
+	assert.Equal(t, 1, c.lru.Len())
+
+	key, err := NewPRNGKey(seeds[0])
+	assert.Nil(t, err)
+	expected, err := key.PRNG(CounterNonce(1))
+	assert.Nil(t, err)
+	assert.Equal(t, *expected, *r)
+
+	// the least recently used key is evicted and wiped
+	c.prng(seeds[1], CounterNonce(1))
+	c.prng(seeds[2], CounterNonce(1))
+	assert.Equal(t, 2, c.lru.Len())
+	assert.Nil(t, keyA.key, "evicted key not wiped")
+	_, err = c.prng(seeds[0], CounterNonce(2))
+	assert.Nil(t, err)
+
+	_, err = c.prng(seeds[0], []byte("short"))
+	assert.ErrorIs(t, err, ErrInvalidNonce)
+}
+
+func TestNonceChecker(t *testing.T) {
+	var c NonceChecker
+	assert.Nil(t, c.Check(CounterNonce(0)))
+	assert.Nil(t, c.Check(CounterNonce(1)))
+	assert.Nil(t, c.Check(CounterNonce(1<<40)))
+
+	assert.ErrorIs(t, c.Check(CounterNonce(1<<40)), ErrNonceReused)
+	assert.ErrorIs(t, c.Check(CounterNonce(2)), ErrNonceReused)
+	assert.ErrorIs(t, c.Check(CounterNonce(0)), ErrNonceReused)
+	assert.ErrorIs(t, c.Check([]byte("short")), ErrInvalidNonce)
+	assert.Nil(t, c.Check(CounterNonce(1<<40+1)))
+}
+
+func BenchmarkPRNGWithNonce(b *testing.B) {
+	key, _ := NewPRNGKey([]byte("seed"))
+	nonce := make([]byte, NONCE_SIZE)
+	for i := 0; i < b.N; i++ {
+		key.PRNG(nonce)
+	}
+}
+
+func BenchmarkCreatePRNGWithNonce(b *testing.B) {
+	seed := []byte("seed")
+	nonce := make([]byte, NONCE_SIZE)
+	for i := 0; i < b.N; i++ {
+		CreatePRNGWithNonce(seed, nonce)
+	}
+}
@@ -0,0 +1,178 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+)
+
+// Errors returned by New when the configuration is rejected
+var (
+	ErrSeedTooShort     = errors.New("qpp: seed too short")
+	ErrInvalidPadCount  = errors.New("qpp: invalid pad count")
+	ErrInvalidQubits    = errors.New("qpp: invalid number of qubits")
+	ErrInvalidPadSwitch = errors.New("qpp: invalid pad switch interval")
+	ErrInvalidWorkers   = errors.New("qpp: invalid number of workers")
+	ErrInvalidVersion   = errors.New("qpp: invalid pad derivation version")
+	ErrInvalidRole      = errors.New("qpp: invalid duplex role")
+)
+
+// Options configures the Quantum Permutation Pad created by New
+// The zero value of each optional field selects the package default.
+type Options struct {
+	NumPads   int   // Number of pads (permutation matrices), required, at most 65535 unless Unbiased, and MAX_PAD_BYTES in total
+	Qubits    uint8 // Number of qubits of each pad, 4, 8 or 16, defaults to QUBITS, 16-qubit data must have even length
+	PadSwitch int   // Switch pad for every PadSwitch symbols (bytes for 8 qubits), 1 to 255, defaults to PAD_SWITCH
+
+	// KDF derives the seed chunks and the PRNG key, nil selects the v1
+	// PBKDF2-HMAC-SHA1 profile which keeps existing ciphertexts decryptable.
+	KDF KDF
+
+	// Context is a domain-separation label mixed into the derivation of pads
+	// and PRNGs, so that one seed can drive several independent services or
+	// tenants without colliding keystreams. Empty keeps the original derivation.
+	Context []byte
+
+	// Workers is the number of goroutines generating pads, defaults to
+	// GOMAXPROCS. The pads are identical for any number of workers.
+	Workers int
+
+	// Version selects the pad derivation algorithm, PADS_V1 or PADS_V2,
+	// defaults to PADS_V1 so that existing seeds produce the same pads.
+	// 16-qubit pads are too large for PADS_V1 and default to PADS_V2.
+	Version int
+
+	// Cache, if set, returns the same read-only PadSet for repeated seeds and
+	// options instead of deriving the pads again, see PadSetCache.
+	Cache *PadSetCache
+
+	// Unbiased selects pads uniformly with Lemire's multiply-shift method
+	// instead of the original 16-bit modulo, and raises the limit on NumPads
+	// to 2^32-1, as far as the tables fit in MAX_PAD_BYTES. Both ends must agree on this mode.
+	Unbiased bool
+
+	// Strict rejects configurations that AdviseConfig reports as weak with
+	// ErrWeakConfig: pad counts sharing a factor with the pad switch interval,
+	// fewer pads than QPPMinimumPads, or seeds shorter than QPPMinimumSeedLength.
+	Strict bool
+
+	// Constraints, if set, makes every pad meet the given cycle constraints,
+	// pads are shuffled again deterministically until they do.
+	Constraints *PadConstraints
+
+	// LockMemory allocates the pads outside of the Go heap in memory that is
+	// locked against swapping, excluded from core dumps and surrounded by guard
+	// pages. It falls back to the heap where this is unsupported or the locked
+	// memory limit is too low, PadSet.Locked reports which one was used.
+	LockMemory bool
+
+	// PRNG selects the algorithm of the PRNGs created by New and PadSet.CreatePRNG,
+	// PRNG_XOSHIRO, PRNG_CHACHA20 or PRNG_AES_CTR, defaults to PRNG_XOSHIRO.
+	// xoshiro256** outputs are XORed into the plaintext and reveal its state,
+	// the CSPRNGs keep the selector stream unpredictable at some cost in speed.
+	// Only xoshiro256** can Jump, LongJump and Split.
+	PRNG int
+
+	// SeparatePads makes NewDuplex derive a pad set per direction instead of
+	// sharing one, it is ignored by New and NewPadSet.
+	SeparatePads bool
+}
+
+// validate checks the seed and the options, and returns a copy of the options
+// with the defaults filled in.
+func (opts *Options) validate(seed []byte) (Options, error) {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+
+	if len(seed) == 0 {
+		return o, fmt.Errorf("%w: seed must not be empty", ErrSeedTooShort)
+	}
+
+	maxPads := uint64(0xFFFF)
+	if o.Unbiased {
+		maxPads = 0xFFFFFFFF
+	}
+	if o.NumPads <= 0 || uint64(o.NumPads) > maxPads {
+		return o, fmt.Errorf("%w: %d, must be in [1, %d]", ErrInvalidPadCount, o.NumPads, maxPads)
+	}
+
+	if o.Qubits == 0 {
+		o.Qubits = QUBITS
+	}
+	if o.Qubits != 4 && o.Qubits != 8 && o.Qubits != 16 {
+		return o, fmt.Errorf("%w: %d, must be 4, 8 or 16", ErrInvalidQubits, o.Qubits)
+	}
+
+	// a pad and its inverse take 2^Qubits symbols each, of two bytes for 16 qubits,
+	// the cap keeps the allocation sane and the table sizes within int on 32-bit platforms
+	padBytes := uint64(2) << o.Qubits
+	if o.Qubits == 16 {
+		padBytes *= 2
+	}
+	if uint64(o.NumPads)*padBytes > MAX_PAD_BYTES {
+		return o, fmt.Errorf("%w: %d pads of %d qubits exceed %d bytes", ErrInvalidPadCount, o.NumPads, o.Qubits, MAX_PAD_BYTES)
+	}
+
+	if o.PadSwitch == 0 {
+		o.PadSwitch = PAD_SWITCH
+	}
+	if o.PadSwitch < 1 || o.PadSwitch > 0xFF {
+		return o, fmt.Errorf("%w: %d, must be in [1, 255]", ErrInvalidPadSwitch, o.PadSwitch)
+	}
+
+	if o.Version == 0 {
+		o.Version = PADS_V1
+		if o.Qubits == 16 {
+			o.Version = PADS_V2
+		}
+	}
+	if o.Version != PADS_V1 && o.Version != PADS_V2 {
+		return o, fmt.Errorf("%w: %d", ErrInvalidVersion, o.Version)
+	}
+	if o.Version == PADS_V1 && o.Qubits == 16 {
+		return o, fmt.Errorf("%w: 16-qubit pads require PADS_V2", ErrInvalidVersion)
+	}
+
+	if o.PRNG == 0 {
+		o.PRNG = PRNG_XOSHIRO
+	}
+	if o.PRNG != PRNG_XOSHIRO && o.PRNG != PRNG_CHACHA20 && o.PRNG != PRNG_AES_CTR {
+		return o, fmt.Errorf("%w: %d", ErrInvalidPRNG, o.PRNG)
+	}
+
+	if err := o.Constraints.validate(o.Qubits); err != nil {
+		return o, err
+	}
+
+	if o.Strict {
+		if err := adviseConfig(o.NumPads, len(seed), o.Qubits, o.PadSwitch).Err(); err != nil {
+			return o, err
+		}
+	}
+
+	if o.Workers < 0 {
+		return o, fmt.Errorf("%w: %d", ErrInvalidWorkers, o.Workers)
+	}
+	if o.Workers == 0 {
+		o.Workers = runtime.GOMAXPROCS(0)
+	}
+
+	return o, nil
+}
@@ -0,0 +1,134 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewInvalidOptions(t *testing.T) {
+	seed := make([]byte, 32)
+	io.ReadFull(rand.Reader, seed)
+
+	cases := []struct {
+		name string
+		seed []byte
+		opts *Options
+		err  error
+	}{
+		{"nil options", seed, nil, ErrInvalidPadCount},
+		{"empty seed", nil, &Options{NumPads: 7}, ErrSeedTooShort},
+		{"zero pads", seed, &Options{NumPads: 0}, ErrInvalidPadCount},
+		{"negative pads", seed, &Options{NumPads: -1}, ErrInvalidPadCount},
+		{"too many pads", seed, &Options{NumPads: 65536}, ErrInvalidPadCount},
+		{"pads too large", seed, &Options{NumPads: 1<<21 + 1, Unbiased: true}, ErrInvalidPadCount},
+		{"16-qubit pads too large", seed, &Options{NumPads: 4097, Qubits: 16}, ErrInvalidPadCount},
+		{"qubits", seed, &Options{NumPads: 7, Qubits: 7}, ErrInvalidQubits},
+		{"qubits v1", seed, &Options{NumPads: 7, Qubits: 16, Version: PADS_V1}, ErrInvalidVersion},
+		{"pad switch", seed, &Options{NumPads: 7, PadSwitch: -1}, ErrInvalidPadSwitch},
+		{"large pad switch", seed, &Options{NumPads: 7, PadSwitch: 256}, ErrInvalidPadSwitch},
+		{"workers", seed, &Options{NumPads: 7, Workers: -1}, ErrInvalidWorkers},
+		{"version", seed, &Options{NumPads: 7, Version: 3}, ErrInvalidVersion},
+	}
+
+	for _, c := range cases {
+		qpp, err := New(c.seed, c.opts)
+		assert.Nil(t, qpp, c.name)
+		assert.True(t, errors.Is(err, c.err), "%s: unexpected error %v", c.name, err)
+	}
+}
+
+func TestNewMatchesNewQPP(t *testing.T) {
+	seed := make([]byte, 32)
+	io.ReadFull(rand.Reader, seed)
+
+	qpp, err := New(seed, &Options{NumPads: 17})
+	assert.Nil(t, err)
+	legacy := NewQPP(seed, 17)
+	assert.Equal(t, legacy.pads, qpp.pads, "pads differ")
+	assert.Equal(t, legacy.rpads, qpp.rpads, "rpads differ")
+}
+
+func TestNewQPPPanicsOnZeroPads(t *testing.T) {
+	seed := make([]byte, 32)
+	io.ReadFull(rand.Reader, seed)
+	assert.Panics(t, func() { NewQPP(seed, 0) })
+}
+
+func TestContextSeparation(t *testing.T) {
+	seed := make([]byte, 32)
+	io.ReadFull(rand.Reader, seed)
+
+	legacy := NewQPP(seed, 7)
+	empty, err := New(seed, &Options{NumPads: 7, Context: []byte{}})
+	assert.Nil(t, err)
+	assert.Equal(t, legacy.pads, empty.pads, "empty context must keep the original pads")
+	assert.Equal(t, CreatePRNG(seed), empty.CreatePRNG(seed), "empty context must keep the original PRNG")
+
+	serviceA, err := New(seed, &Options{NumPads: 7, Context: []byte("service-a")})
+	assert.Nil(t, err)
+	serviceB, err := New(seed, &Options{NumPads: 7, Context: []byte("service-b")})
+	assert.Nil(t, err)
+	assert.NotEqual(t, legacy.pads, serviceA.pads)
+	assert.NotEqual(t, serviceA.pads, serviceB.pads)
+	assert.NotEqual(t, serviceA.CreatePRNG(seed), serviceB.CreatePRNG(seed))
+
+	receiver, err := New(seed, &Options{NumPads: 7, Context: []byte("service-a")})
+	assert.Nil(t, err)
+	original := make([]byte, 4096)
+	io.ReadFull(rand.Reader, original)
+	msg := make([]byte, len(original))
+	copy(msg, original)
+	serviceA.Encrypt(msg)
+	receiver.Decrypt(msg)
+	assert.Equal(t, original, msg, "not equal")
+}
+
+func TestParallelPadsMatchSequential(t *testing.T) {
+	seed := make([]byte, 32)
+	io.ReadFull(rand.Reader, seed)
+
+	sequential, err := New(seed, &Options{NumPads: 977, Workers: 1})
+	assert.Nil(t, err)
+
+	for _, workers := range []int{0, 2, 3, 8, 2000} {
+		parallel, err := New(seed, &Options{NumPads: 977, Workers: workers})
+		assert.Nil(t, err)
+		assert.Equal(t, sequential.pads, parallel.pads, "pads differ with %d workers", workers)
+		assert.Equal(t, sequential.rpads, parallel.rpads, "rpads differ with %d workers", workers)
+	}
+}
+
+func BenchmarkNewSequential(b *testing.B) {
+	benchmarkNew(b, 1)
+}
+
+func BenchmarkNewParallel(b *testing.B) {
+	benchmarkNew(b, 0)
+}
+
+func benchmarkNew(b *testing.B, workers int) {
+	seed := make([]byte, 32)
+	io.ReadFull(rand.Reader, seed)
+	for i := 0; i < b.N; i++ {
+		_, _ = New(seed, &Options{NumPads: 977, Workers: workers})
+	}
+}
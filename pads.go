@@ -0,0 +1,104 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned when loading externally supplied permutation pads
+var (
+	ErrInvalidPermutation = errors.New("qpp: pad is not a permutation of 0..255")
+	ErrIdentityPad        = errors.New("qpp: pad is the identity permutation")
+	ErrDuplicatePad       = errors.New("qpp: duplicate pad")
+)
+
+// NewQPPFromPads creates a Quantum Permutation Pad instance from externally supplied permutations,
+// such as gates produced by a hardware QRNG, instead of deriving them from a seed.
+// Each pad must be a bijection on 0..255, and both default PRNGs are derived from prngSeed.
+func NewQPPFromPads(pads [][]byte, prngSeed []byte) (*QuantumPermutationPad, error) {
+	if len(prngSeed) == 0 {
+		return nil, fmt.Errorf("%w: PRNG seed must not be empty", ErrSeedTooShort)
+	}
+
+	ps, err := NewPadSetFromPads(pads)
+	if err != nil {
+		return nil, err
+	}
+
+	encRand := ps.CreatePRNG(prngSeed)
+	decRand := ps.CreatePRNG(prngSeed)
+	return &QuantumPermutationPad{Session: *NewSession(ps, encRand, decRand)}, nil
+}
+
+// NewPadSetFromPads creates an 8-qubit pad set from externally supplied permutations
+// It rejects pads that are not a bijection on 0..255, identity pads and duplicate pads.
+// The pads are copied, so the caller may wipe its own slices afterwards.
+func NewPadSetFromPads(pads [][]byte) (*PadSet, error) {
+	if len(pads) == 0 || len(pads) > 0xFFFF {
+		return nil, fmt.Errorf("%w: %d, must be in [1, 65535]", ErrInvalidPadCount, len(pads))
+	}
+
+	matrixBytes := 1 << QUBITS
+	seen := make(map[string]int, len(pads))
+	for i, pad := range pads {
+		if err := checkPermutation(pad, matrixBytes); err != nil {
+			return nil, fmt.Errorf("%w: pad %d", err, i)
+		}
+		if j, ok := seen[string(pad)]; ok {
+			return nil, fmt.Errorf("%w: pad %d equals pad %d", ErrDuplicatePad, i, j)
+		}
+		seen[string(pad)] = i
+	}
+
+	ps := &PadSet{
+		numPads:   uint32(len(pads)),
+		qubits:    QUBITS,
+		padSwitch: PAD_SWITCH,
+		unrolled:  true,
+		derive:    v1Derivation,
+	}
+	ps.allocTables(len(pads)*matrixBytes, false)
+
+	for i, pad := range pads {
+		copy(ps.pads[i*matrixBytes:], pad)
+		reverse(pad, ps.rpads[i*matrixBytes:(i+1)*matrixBytes])
+	}
+	return ps, nil
+}
+
+// checkPermutation checks that pad is a non-identity bijection on 0..n-1
+func checkPermutation(pad []byte, n int) error {
+	if len(pad) != n {
+		return fmt.Errorf("%w: length %d", ErrInvalidPermutation, len(pad))
+	}
+
+	var seen [256]bool
+	identity := true
+	for i, v := range pad {
+		if seen[v] {
+			return fmt.Errorf("%w: value %d repeated", ErrInvalidPermutation, v)
+		}
+		seen[v] = true
+		identity = identity && int(v) == i
+	}
+
+	if identity {
+		return ErrIdentityPad
+	}
+	return nil
+}
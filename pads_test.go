@@ -0,0 +1,96 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+import (
+	"crypto/rand"
+	"io"
+	mathrand "math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// randomPads returns n random permutations of 0..255
+func randomPads(n int) [][]byte {
+	pads := make([][]byte, n)
+	for i := range pads {
+		pads[i] = make([]byte, 256)
+		for j, v := range mathrand.Perm(256) {
+			pads[i][j] = byte(v)
+		}
+	}
+	return pads
+}
+
+func TestNewQPPFromPads(t *testing.T) {
+	pads := randomPads(13)
+	prngSeed := make([]byte, 32)
+	io.ReadFull(rand.Reader, prngSeed)
+
+	sender, err := NewQPPFromPads(pads, prngSeed)
+	assert.Nil(t, err)
+	receiver, err := NewQPPFromPads(pads, prngSeed)
+	assert.Nil(t, err)
+
+	for i, pad := range pads {
+		assert.Equal(t, pad, sender.pads[i*256:(i+1)*256])
+		for j := range 256 {
+			assert.Equal(t, byte(j), sender.rpads[i*256+int(pad[j])], "not reversible")
+		}
+	}
+
+	original := make([]byte, 65536)
+	io.ReadFull(rand.Reader, original)
+	msg := append([]byte(nil), original...)
+	sender.Encrypt(msg)
+	assert.NotEqual(t, original, msg, "not encrypted")
+	receiver.Decrypt(msg)
+	assert.Equal(t, original, msg, "not equal")
+
+	// the caller's pads are copied
+	clear(pads[0])
+	assert.NotEqual(t, pads[0], sender.pads[:256])
+}
+
+func TestNewQPPFromPadsInvalid(t *testing.T) {
+	prngSeed := []byte("prng seed")
+
+	_, err := NewQPPFromPads(nil, prngSeed)
+	assert.ErrorIs(t, err, ErrInvalidPadCount)
+	_, err = NewQPPFromPads(randomPads(1), nil)
+	assert.ErrorIs(t, err, ErrSeedTooShort)
+
+	short := randomPads(2)
+	short[1] = short[1][:255]
+	_, err = NewQPPFromPads(short, prngSeed)
+	assert.ErrorIs(t, err, ErrInvalidPermutation)
+
+	repeated := randomPads(2)
+	repeated[1][0] = repeated[1][1]
+	_, err = NewQPPFromPads(repeated, prngSeed)
+	assert.ErrorIs(t, err, ErrInvalidPermutation)
+
+	identity := randomPads(2)
+	fill(identity[1])
+	_, err = NewQPPFromPads(identity, prngSeed)
+	assert.ErrorIs(t, err, ErrIdentityPad)
+
+	duplicate := randomPads(3)
+	copy(duplicate[2], duplicate[0])
+	_, err = NewQPPFromPads(duplicate, prngSeed)
+	assert.ErrorIs(t, err, ErrDuplicatePad)
+}
@@ -39,6 +39,32 @@ func xorshift16(state uint16) uint16 {
 	return state
 }
 
+// goldenGamma is the odd constant 2^64/φ, added before remixing so that a zero word cannot get stuck
+const goldenGamma = 0x9E3779B97F4A7C15
+
+// uniformIndex maps the random word r to an unbiased index in [0, n) with Lemire's
+// multiply-shift method. Rejected words are remixed with xorshift64* instead of
+// drawing from the PRNG, so the index stays a pure function of r and the selector
+// stream is consumed exactly as in the biased mode.
+func uniformIndex(r uint64, n uint32) uint32 {
+	m := uint64(uint32(r)) * uint64(n)
+	if uint32(m) < n { // rarely taken, keeps this function inlinable
+		return uniformIndexSlow(r, n)
+	}
+	return uint32(m >> 32)
+}
+
+// uniformIndexSlow rejects the words below the bias threshold
+func uniformIndexSlow(r uint64, n uint32) uint32 {
+	threshold := -n % n
+	m := uint64(uint32(r)) * uint64(n)
+	for uint32(m) < threshold {
+		r = xorshift64star(r + goldenGamma)
+		m = uint64(uint32(r)) * uint64(n)
+	}
+	return uint32(m >> 32)
+}
+
 func rol64(x uint64, k int) uint64 {
 	return (x << k) | (x >> (64 - k))
 }
@@ -57,3 +83,11 @@ func xoshiro256ss(s *[4]uint64) uint64 {
 
 	return result
 }
+
+// next returns the next word of xoshiro256** or of the CSPRNG keystream
+func (r *Rand) next() uint64 {
+	if r.keystream != nil {
+		return r.keystream.uint64()
+	}
+	return xoshiro256ss(&r.xoshiro)
+}
@@ -31,3 +31,18 @@ func BenchmarkXorShift32(b *testing.B) {
 		state = xorshift32(state)
 	}
 }
+
+func TestUniformIndex(t *testing.T) {
+	// the rejection path must stay in range and be a pure function of r
+	for _, n := range []uint32{1, 3, 977, 40000, 1<<31 + 1, 0xFFFFFFFF} {
+		for r := uint64(0); r < 1000; r++ {
+			idx := uniformIndex(r, n)
+			if idx >= n {
+				t.Fatalf("index %d out of range [0, %d)", idx, n)
+			}
+			if idx != uniformIndex(r, n) {
+				t.Fatalf("index of %d not deterministic", r)
+			}
+		}
+	}
+}
@@ -24,14 +24,18 @@ import (
 	"encoding/binary"
 	"fmt"
 	"math/big"
+	"runtime"
+	"sync"
 	"unsafe"
 
 	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/sha3"
 )
 
 // Constants used in Quantum Permutation Pad (QPP) for identifiers, salts, and configuration
 const (
 	PAD_IDENTIFIER         = "QPP_%b"
+	PAD_RETRY_IDENTIFIER   = "QPP_%b_RETRY_%b"
 	PM_SELECTOR_IDENTIFIER = "PERMUTATION_MATRIX_SELECTOR"
 	SHUFFLE_SALT           = "___QUANTUM_PERMUTATION_PAD_SHUFFLE_SALT___"
 	PRNG_SALT              = "___QUANTUM_PERMUTATION_PAD_PRNG_SALT___"
@@ -41,127 +45,318 @@ const (
 	CHUNK_DERIVE_LOOPS     = 1024
 	PAD_SWITCH             = 8 // switch pad for every PAD_SWITCH bytes
 	QUBITS                 = 8 // number of quantum bits of this implementation
+
+	MAX_PAD_BYTES = 1 << 30 // limit on the bytes of the pads and their inverses of a pad set
 )
 
 // Rand is a stateful random number generator
 type Rand struct {
 	xoshiro [4]uint64 // xoshiro state
+	origin  [4]uint64 // xoshiro state the stream started from, for Seek
 	seed64  uint64    // the latest random number
 	count   uint8     // number of bytes encrypted, counted in modular arithmetic
+
+	keystream *keystream // CSPRNG source replacing xoshiro, nil for xoshiro256**
+
+	destroyed bool // set by Destroy, the state has been wiped
 }
 
-// QuantumPermutationPad represents the encryption/decryption structure using quantum permutation pads
-// QPP is a cryptographic technique that leverages quantum-inspired permutation matrices to provide secure encryption.
-type QuantumPermutationPad struct {
+// PadSet holds the permutation pads derived from a seed
+// A PadSet is immutable once created until it is destroyed, so a single PadSet can be shared by any number of goroutines and sessions.
+type PadSet struct {
 	pads     []byte         // Encryption pads, each pad is a permutation matrix for encryption
 	rpads    []byte         // Decryption pads, each pad is a reverse permutation matrix for decryption
 	padsPtr  unsafe.Pointer // raw pointer to encryption pads
 	rpadsPtr unsafe.Pointer // raw pointer to decryption pads
 
-	numPads uint16 // Number of pads (permutation matrices)
-	encRand *Rand  // Default random source for encryption pad selection
-	decRand *Rand  // Default random source for decryption pad selection
+	pads16  []uint16 // Encryption pads of 16-qubit pad sets, sharing memory with pads
+	rpads16 []uint16 // Decryption pads of 16-qubit pad sets, sharing memory with rpads
+
+	numPads   uint32     // Number of pads (permutation matrices)
+	qubits    uint8      // Number of qubits, each pad permutes 2^qubits symbols
+	padSwitch int        // Switch pad for every padSwitch symbols
+	unbiased  bool       // Select pads with Lemire's method instead of a 16-bit modulo
+	unrolled  bool       // 8 qubits, handled by the byte paths
+	derive    derivation // Key derivation functions of this pad set
+
+	mem       []*lockedBuffer // locked allocations backing pads and rpads, nil for heap tables
+	cache     *PadSetCache    // cache handing out the pad set, which guards holders and evicted
+	holders   int             // pad sets handed out by the cache and not destroyed yet
+	evicted   bool            // no longer in the cache, wiped once holders drops to zero
+	destroyed bool            // set by Destroy, the pads have been wiped
+}
+
+// QuantumPermutationPad represents the encryption/decryption structure using quantum permutation pads
+// QPP is a cryptographic technique that leverages quantum-inspired permutation matrices to provide secure encryption.
+// It is a Session bound to a PadSet of its own, with both PRNGs derived from the seed.
+type QuantumPermutationPad struct {
+	Session
 }
 
 // NewQPP creates a new Quantum Permutation Pad instance with the provided seed, number of pads, and qubits
 // The seed is used to generate deterministic pseudo-random number generators (PRNGs) for both encryption and decryption
+// NewQPP panics if the configuration is invalid, use New to get an error instead.
 func NewQPP(seed []byte, numPads uint16) *QuantumPermutationPad {
-	qpp := &QuantumPermutationPad{
-		numPads: numPads,
+	qpp, err := New(seed, &Options{NumPads: int(numPads)})
+	if err != nil {
+		panic(fmt.Sprintf("NewQPP: %v", err))
+	}
+	return qpp
+}
+
+// New creates a new Quantum Permutation Pad instance with the provided seed and options
+// The seed and options are validated up front, and an error is returned if any of them is invalid.
+func New(seed []byte, opts *Options) (*QuantumPermutationPad, error) {
+	ps, err := NewPadSet(seed, opts)
+	if err != nil {
+		return nil, err
 	}
 
-	matrixBytes := 1 << QUBITS
-	qpp.pads = make([]byte, int(numPads)*matrixBytes)
-	qpp.rpads = make([]byte, int(numPads)*matrixBytes)
-	qpp.padsPtr = unsafe.Pointer(unsafe.SliceData(qpp.pads))
-	qpp.rpadsPtr = unsafe.Pointer(unsafe.SliceData(qpp.rpads))
+	// Create default PRNGs for encryption and decryption
+	encRand, err := createPRNG(seed, ps.derive)
+	if err != nil {
+		ps.Destroy()
+		return nil, err
+	}
+	decRand, err := createPRNG(seed, ps.derive)
+	if err != nil {
+		encRand.Destroy()
+		ps.Destroy()
+		return nil, err
+	}
+
+	return &QuantumPermutationPad{Session: *NewSession(ps, encRand, decRand)}, nil
+}
 
-	chunks := seedToChunks(seed, QUBITS)
-	// creat AES-256 blocks to generate random number for shuffling
+// NewPadSet derives the permutation pads from the provided seed and options
+// If opts.Cache is set, pad sets are shared for repeated seeds and options.
+func NewPadSet(seed []byte, opts *Options) (*PadSet, error) {
+	o, err := opts.validate(seed)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.Cache != nil {
+		return o.Cache.get(seed, o)
+	}
+	return newPadSet(seed, o)
+}
+
+// newPadSet generates the pads from the seed and validated options
+func newPadSet(seed []byte, o Options) (*PadSet, error) {
+	numPads := uint32(o.NumPads)
+	ps := &PadSet{
+		numPads:   numPads,
+		qubits:    o.Qubits,
+		padSwitch: o.PadSwitch,
+		unbiased:  o.Unbiased,
+		unrolled:  o.Qubits == QUBITS,
+		derive:    newDerivation(o.KDF, o.Context, o.PRNG),
+	}
+
+	chunks, err := seedToChunks(seed, o.Qubits, ps.derive)
+	if err != nil {
+		return nil, err
+	}
+	defer wipeChunks(chunks)
+
+	// creat AES-256 blocks to generate random number for shuffling, v2 draws from SHAKE256 instead
 	var blocks []cipher.Block
-	for _, chunk := range chunks {
-		aeskey := pbkdf2.Key(chunk, []byte(SHUFFLE_SALT), PBKDF2_LOOPS, 32, sha1.New)
-		block, err := aes.NewCipher(aeskey)
+	if o.Version == PADS_V1 {
+		for _, chunk := range chunks {
+			aeskey := pbkdf2.Key(chunk, ps.derive.label(SHUFFLE_SALT), PBKDF2_LOOPS, 32, sha1.New)
+			// the expanded key schedule inside block cannot be reached, only the key is wiped
+			block, err := aes.NewCipher(aeskey)
+			clear(aeskey)
+			if err != nil {
+				return nil, fmt.Errorf("qpp: failed to create AES cipher block: %w", err)
+			}
+			blocks = append(blocks, block)
+		}
+	}
+
+	// the tables are allocated once nothing but the pad derivation can fail,
+	// which destroys them
+	matrixBytes := 1 << o.Qubits
+	ps.allocTables(int(numPads)*matrixBytes, o.LockMemory)
+
+	// Initialize and shuffle pads to create permutation matrices, pads are
+	// independent of each other so they are generated by a pool of workers
+	d := &padDeriver{
+		version:     o.Version,
+		chunks:      chunks,
+		blocks:      blocks,
+		context:     ps.derive.context,
+		constraints: o.Constraints,
+	}
+	workers := min(o.Workers, int(numPads))
+	errs := make([]error, workers)
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := w; i < int(numPads) && errs[w] == nil; i += workers {
+				if o.Qubits == 16 {
+					errs[w] = derivePad(d, ps.pads16[i*matrixBytes:(i+1)*matrixBytes], ps.rpads16[i*matrixBytes:(i+1)*matrixBytes], uint32(i))
+				} else {
+					errs[w] = derivePad(d, ps.pads[i*matrixBytes:(i+1)*matrixBytes], ps.rpads[i*matrixBytes:(i+1)*matrixBytes], uint32(i))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
 		if err != nil {
-			panic(fmt.Sprintf("NewQPP: failed to create AES cipher block: %v", err))
+			ps.Destroy()
+			return nil, err
 		}
-		blocks = append(blocks, block)
 	}
+	return ps, nil
+}
 
-	// Initialize and shuffle pads to create permutation matrices
-	for i := range int(numPads) {
-		pad := qpp.pads[i*matrixBytes : (i+1)*matrixBytes]
-		rpad := qpp.rpads[i*matrixBytes : (i+1)*matrixBytes]
+// padDeriver holds everything needed to derive a pad from its identifier
+type padDeriver struct {
+	version     int
+	chunks      [][]byte
+	blocks      []cipher.Block
+	context     []byte
+	constraints *PadConstraints
+}
+
+// derivePad fills, shuffles and reverses pad padID, shuffling again with a new
+// attempt number until the pad meets the constraints, so both ends derive the same pad.
+func derivePad[T byte | uint16](d *padDeriver, pad, rpad []T, padID uint32) error {
+	for attempt := uint32(0); ; attempt++ {
+		if attempt == MAX_PAD_ATTEMPTS {
+			return fmt.Errorf("%w: pad %d after %d attempts", ErrConstraintsUnsatisfiable, padID, attempt)
+		}
 
-		// Fill pad with sequential byte values
+		// Fill pad with sequential symbol values
 		fill(pad)
 		// Shuffle pad to create a unique permutation matrix
-		shuffle(chunks[i%len(chunks)], pad, uint16(i), blocks)
-		// Create the reverse permutation matrix for decryption
-		reverse(pad, rpad)
+		identifier := padIdentifier(padID, attempt)
+		switch d.version {
+		case PADS_V1:
+			// 16-qubit pads are rejected for PADS_V1 by validate
+			shuffle(d.chunks[int(padID)%len(d.chunks)], any(pad).([]byte), identifier, d.blocks, d.context)
+		case PADS_V2:
+			shuffleV2(d.chunks, pad, identifier, d.context)
+		}
+
+		if d.constraints.satisfied(pad) {
+			break
+		}
 	}
 
-	qpp.encRand = CreatePRNG(seed) // Create default PRNG for encryption
-	qpp.decRand = CreatePRNG(seed) // Create default PRNG for decryption
+	// Create the reverse permutation matrix for decryption
+	reverse(pad, rpad)
+	return nil
+}
 
-	return qpp
+// padIdentifier returns the identifier of a pad, retries after a failed constraint check get a distinct identifier
+func padIdentifier(padID, attempt uint32) string {
+	if attempt == 0 {
+		return fmt.Sprintf(PAD_IDENTIFIER, padID)
+	}
+	return fmt.Sprintf(PAD_RETRY_IDENTIFIER, padID, attempt)
 }
 
-// Encrypt encrypts the given data using the Quantum Permutation Pad with the default PRNG
-// It selects a permutation matrix based on a random index and uses it to permute each byte of the data
-func (qpp *QuantumPermutationPad) Encrypt(data []byte) {
-	qpp.EncryptWithPRNG(data, qpp.encRand)
+// padIndex returns the index of the pad selected by the random word r
+// The default selection is the original 16-bit modulo, which is biased whenever the
+// number of pads is not a power of two; the unbiased mode uses Lemire's method instead.
+func (ps *PadSet) padIndex(r uint64) uint32 {
+	if ps.unbiased {
+		return uniformIndex(r, ps.numPads)
+	}
+	return uint32(uint16(r) % uint16(ps.numPads))
 }
 
-// Decrypt decrypts the given data using the Quantum Permutation Pad with the default PRNG
-// It selects a reverse permutation matrix based on a random index and uses it to restore each byte of the data
-func (qpp *QuantumPermutationPad) Decrypt(data []byte) {
-	qpp.DecryptWithPRNG(data, qpp.decRand)
+// padOffset returns the byte offset of the 8-qubit pad selected by the random word r
+func (ps *PadSet) padOffset(r uint64) uintptr {
+	return uintptr(ps.padIndex(r)) << 8
 }
 
 // CreatePRNG creates a deterministic pseudo-random number generator based on the provided seed
 // It uses HMAC and PBKDF2 to derive a random seed for the PRNG
 func CreatePRNG(seed []byte) *Rand {
+	rd, err := createPRNG(seed, v1Derivation)
+	if err != nil {
+		panic(fmt.Sprintf("CreatePRNG: %v", err))
+	}
+	return rd
+}
+
+// CreatePRNG creates a deterministic pseudo-random number generator based on the provided seed,
+// using the key derivation function and context this pad set was created with.
+// It panics if the KDF fails, which for the built-in KDFs only happens on invalid parameters already rejected by New.
+func (ps *PadSet) CreatePRNG(seed []byte) *Rand {
+	rd, err := createPRNG(seed, ps.derive)
+	if err != nil {
+		panic(fmt.Sprintf("CreatePRNG: %v", err))
+	}
+	return rd
+}
+
+// createPRNG derives the PRNG key of the seed and creates the PRNG from it
+func createPRNG(seed []byte, d derivation) (*Rand, error) {
+	key, err := derivePRNGKey(seed, d)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(key)
+
+	// Create and return PRNG
+	return newRand(key, d.prng)
+}
+
+// derivePRNGKey uses HMAC and the light KDF of the derivation to derive a 32-byte random seed for the PRNG
+func derivePRNGKey(seed []byte, d derivation) ([]byte, error) {
 	mac := hmac.New(sha256.New, seed)
-	mac.Write([]byte(PM_SELECTOR_IDENTIFIER))
+	mac.Write(d.label(PM_SELECTOR_IDENTIFIER))
 	sum := mac.Sum(nil)
+	defer clear(sum)
 
-	// Derive a key for xoroshiro256**
-	xoshiro := pbkdf2.Key(sum, []byte(PRNG_SALT), PBKDF2_LOOPS, 32, sha1.New)
-	// Create and return PRNG
-	rd := &Rand{}
-	rd.xoshiro[0] = binary.LittleEndian.Uint64(xoshiro[0:8])
-	rd.xoshiro[1] = binary.LittleEndian.Uint64(xoshiro[8:16])
-	rd.xoshiro[2] = binary.LittleEndian.Uint64(xoshiro[16:24])
-	rd.xoshiro[3] = binary.LittleEndian.Uint64(xoshiro[24:32])
-	rd.seed64 = xoshiro256ss(&rd.xoshiro)
-	return rd
+	// Derive a key for xoroshiro256** or the keystream
+	return d.light.Key(sum, d.label(PRNG_SALT), 32)
 }
 
 // FastPRNG creates a deterministic pseudo-random number generator based on the provided seed, but with a faster initialization,
 // it's suitable for the cases where the seed have sufficient randomness.
 func FastPRNG(seed []byte) *Rand {
+	rd, _ := fastPRNG(seed, PRNG_XOSHIRO)
+	return rd
+}
+
+// fastPRNG creates a PRNG of the given algorithm keyed by the SHA-256 of the seed
+func fastPRNG(seed []byte, prng int) (*Rand, error) {
 	sum := sha256.Sum256(seed)
+	defer clear(sum[:])
 
 	// Create and return PRNG
-	rd := &Rand{}
-	rd.xoshiro[0] = binary.LittleEndian.Uint64(sum[0:8])
-	rd.xoshiro[1] = binary.LittleEndian.Uint64(sum[8:16])
-	rd.xoshiro[2] = binary.LittleEndian.Uint64(sum[16:24])
-	rd.xoshiro[3] = binary.LittleEndian.Uint64(sum[24:32])
-	rd.seed64 = xoshiro256ss(&rd.xoshiro)
-	return rd
+	return newRand(sum[:], prng)
 }
 
 // EncryptWithPRNG encrypts the data using the Quantum Permutation Pad with a custom PRNG
 // The PRNG exposes 64-bit chunks; the `count` field tracks how many bytes of the
 // current 64-bit word have already been consumed so that successive calls remain
 // byte-aligned even if the caller streams arbitrary lengths.
-func (qpp *QuantumPermutationPad) EncryptWithPRNG(data []byte, rand *Rand) {
+func (ps *PadSet) EncryptWithPRNG(data []byte, rand *Rand) {
+	ps.checkAlive(rand)
+	if !ps.unrolled {
+		ps.cryptSymbols(data, rand, false)
+		return
+	}
+	if ps.padSwitch != PAD_SWITCH {
+		ps.cryptBytes(data, rand, false)
+		return
+	}
+
 	// initial r, index, count
 	size := len(data)
 	r := rand.seed64
-	base := unsafe.Add(qpp.padsPtr, uintptr(uint16(r)%qpp.numPads)<<8)
+	base := unsafe.Add(ps.padsPtr, ps.padOffset(r))
 	count := rand.count
 	var rr byte
 
@@ -178,8 +373,8 @@ func (qpp *QuantumPermutationPad) EncryptWithPRNG(data []byte, rand *Rand) {
 			if count == PAD_SWITCH {
 				// Once we exhaust PAD_SWITCH bytes we reseed from xoshiro, select a new pad,
 				// and realign the loop so the remaining bytes can be handled in 8-byte chunks.
-				r = xoshiro256ss(&rand.xoshiro)
-				base = unsafe.Add(qpp.padsPtr, uintptr(uint16(r)%qpp.numPads)<<8)
+				r = rand.next()
+				base = unsafe.Add(ps.padsPtr, ps.padOffset(r))
 				// `offset` is advanced to skip the byte we just finished so the slice below
 				// starts at the first unprocessed byte. Without this the processed byte would
 				// be re-encrypted when we fall through to the aligned logic.
@@ -213,8 +408,13 @@ func (qpp *QuantumPermutationPad) EncryptWithPRNG(data []byte, rand *Rand) {
 		d[6] = *(*byte)(unsafe.Add(base, (d[6] ^ rr6)))
 		d[7] = *(*byte)(unsafe.Add(base, (d[7] ^ rr7)))
 
-		r = xoshiro256ss(&rand.xoshiro)
-		base = unsafe.Add(qpp.padsPtr, uintptr(uint16(r)%qpp.numPads)<<8)
+		// branch here rather than in next to save a call per word for xoshiro256**
+		if rand.keystream == nil {
+			r = xoshiro256ss(&rand.xoshiro)
+		} else {
+			r = rand.keystream.uint64()
+		}
+		base = unsafe.Add(ps.padsPtr, ps.padOffset(r))
 	}
 	data = data[repeat*8:]
 
@@ -228,14 +428,27 @@ func (qpp *QuantumPermutationPad) EncryptWithPRNG(data []byte, rand *Rand) {
 	// set back r & count
 	rand.seed64 = uint64(r)
 	rand.count = uint8((int(rand.count) + size) % PAD_SWITCH)
+
+	// base is a raw pointer into the pads, keep ps and its finalizer at bay until here
+	runtime.KeepAlive(ps)
 }
 
 // DecryptWithPRNG mirrors EncryptWithPRNG but walks the reverse permutation pads so that
 // the cipher stream remains synchronized with the same PRNG state.
-func (qpp *QuantumPermutationPad) DecryptWithPRNG(data []byte, rand *Rand) {
+func (ps *PadSet) DecryptWithPRNG(data []byte, rand *Rand) {
+	ps.checkAlive(rand)
+	if !ps.unrolled {
+		ps.cryptSymbols(data, rand, true)
+		return
+	}
+	if ps.padSwitch != PAD_SWITCH {
+		ps.cryptBytes(data, rand, true)
+		return
+	}
+
 	size := len(data)
 	r := rand.seed64
-	base := unsafe.Add(qpp.rpadsPtr, uintptr(uint16(r)%qpp.numPads)<<8)
+	base := unsafe.Add(ps.rpadsPtr, ps.padOffset(r))
 	count := rand.count
 	var rr byte
 
@@ -248,8 +461,8 @@ func (qpp *QuantumPermutationPad) DecryptWithPRNG(data []byte, rand *Rand) {
 			count++
 
 			if count == PAD_SWITCH {
-				r = xoshiro256ss(&rand.xoshiro)
-				base = unsafe.Add(qpp.rpadsPtr, uintptr(uint16(r)%qpp.numPads)<<8)
+				r = rand.next()
+				base = unsafe.Add(ps.rpadsPtr, ps.padOffset(r))
 				// Advance `offset` for the same reason as encryption: ensure the slice below
 				// resumes at the first unprocessed byte after we switch pads.
 				offset = offset + 1
@@ -282,8 +495,13 @@ func (qpp *QuantumPermutationPad) DecryptWithPRNG(data []byte, rand *Rand) {
 		d[6] = *(*byte)(unsafe.Add(base, d[6])) ^ rr6
 		d[7] = *(*byte)(unsafe.Add(base, d[7])) ^ rr7
 
-		r = xoshiro256ss(&rand.xoshiro)
-		base = unsafe.Add(qpp.rpadsPtr, uintptr(uint16(r)%qpp.numPads)<<8)
+		// branch here rather than in next to save a call per word for xoshiro256**
+		if rand.keystream == nil {
+			r = xoshiro256ss(&rand.xoshiro)
+		} else {
+			r = rand.keystream.uint64()
+		}
+		base = unsafe.Add(ps.rpadsPtr, ps.padOffset(r))
 	}
 	data = data[repeat*8:]
 
@@ -298,11 +516,116 @@ func (qpp *QuantumPermutationPad) DecryptWithPRNG(data []byte, rand *Rand) {
 	// set back r & count
 	rand.seed64 = r
 	rand.count = uint8((int(rand.count) + size) % PAD_SWITCH)
+
+	// base is a raw pointer into the rpads, keep ps and its finalizer at bay until here
+	runtime.KeepAlive(ps)
+}
+
+// cryptBytes runs 8-qubit pads switched every padSwitch bytes, other than PAD_SWITCH, in the
+// stream of cryptSymbols: byte k of a segment is masked by byte k%8 of its k/8-th mask word.
+// Whole mask words are unrolled and switch pads inline, so intervals that are multiples
+// of 8 only take the byte-by-byte path at the edges of the data.
+func (ps *PadSet) cryptBytes(data []byte, rand *Rand, decrypt bool) {
+	table := ps.padsPtr
+	if decrypt {
+		table = ps.rpadsPtr
+	}
+	r, count := rand.seed64, int(rand.count)
+	base := unsafe.Add(table, ps.padOffset(r))
+
+	for len(data) > 0 {
+		// bytes up to the next whole mask word, or the end of the segment
+		if count%8 != 0 || ps.padSwitch-count < 8 || len(data) < 8 {
+			n := min(8-count%8, ps.padSwitch-count, len(data))
+			cryptMasked(data[:n], base, segmentWord(r, count/8), count%8, decrypt)
+			data = data[n:]
+			count += n
+			if count == ps.padSwitch {
+				if rand.keystream == nil {
+					r = xoshiro256ss(&rand.xoshiro)
+				} else {
+					r = rand.keystream.uint64()
+				}
+				base = unsafe.Add(table, ps.padOffset(r))
+				count = 0
+			}
+			continue
+		}
+
+		// whole mask words, as long as the segment holds one
+		for len(data) >= 8 && ps.padSwitch-count >= 8 {
+			w := segmentWord(r, count/8)
+			d := data[:8:8]
+			if decrypt {
+				d[0] = *(*byte)(unsafe.Add(base, d[0])) ^ byte(w)
+				d[1] = *(*byte)(unsafe.Add(base, d[1])) ^ byte(w>>8)
+				d[2] = *(*byte)(unsafe.Add(base, d[2])) ^ byte(w>>16)
+				d[3] = *(*byte)(unsafe.Add(base, d[3])) ^ byte(w>>24)
+				d[4] = *(*byte)(unsafe.Add(base, d[4])) ^ byte(w>>32)
+				d[5] = *(*byte)(unsafe.Add(base, d[5])) ^ byte(w>>40)
+				d[6] = *(*byte)(unsafe.Add(base, d[6])) ^ byte(w>>48)
+				d[7] = *(*byte)(unsafe.Add(base, d[7])) ^ byte(w>>56)
+			} else {
+				d[0] = *(*byte)(unsafe.Add(base, d[0]^byte(w)))
+				d[1] = *(*byte)(unsafe.Add(base, d[1]^byte(w>>8)))
+				d[2] = *(*byte)(unsafe.Add(base, d[2]^byte(w>>16)))
+				d[3] = *(*byte)(unsafe.Add(base, d[3]^byte(w>>24)))
+				d[4] = *(*byte)(unsafe.Add(base, d[4]^byte(w>>32)))
+				d[5] = *(*byte)(unsafe.Add(base, d[5]^byte(w>>40)))
+				d[6] = *(*byte)(unsafe.Add(base, d[6]^byte(w>>48)))
+				d[7] = *(*byte)(unsafe.Add(base, d[7]^byte(w>>56)))
+			}
+			data = data[8:]
+
+			// switch to another pad when count reaches padSwitch
+			count += 8
+			if count == ps.padSwitch {
+				if rand.keystream == nil {
+					r = xoshiro256ss(&rand.xoshiro)
+				} else {
+					r = rand.keystream.uint64()
+				}
+				base = unsafe.Add(table, ps.padOffset(r))
+				count = 0
+			}
+		}
+	}
+
+	// set back r & count
+	rand.seed64 = r
+	rand.count = uint8(count)
+
+	// base is a raw pointer into the tables, keep ps and its finalizer at bay until here
+	runtime.KeepAlive(ps)
 }
 
+// cryptMasked permutes the bytes of b through the pad at base, masked by the bytes of w from the first one
+func cryptMasked(b []byte, base unsafe.Pointer, w uint64, first int, decrypt bool) {
+	w >>= first * 8
+	for i := range b {
+		if decrypt {
+			b[i] = *(*byte)(unsafe.Add(base, b[i])) ^ byte(w)
+		} else {
+			b[i] = *(*byte)(unsafe.Add(base, b[i]^byte(w)))
+		}
+		w >>= 8
+	}
+}
+
+// minimumSeedLengths holds QPPMinimumSeedLength for 0 to 16 qubits, the byte length of (2^qubits)!
+var minimumSeedLengths = [...]int{1, 1, 1, 2, 6, 15, 37, 90, 211, 485, 1097, 2448, 5407, 11836, 25719, 55532, 119255}
+
 // QPPMinimumSeedLength calculates the length required for the seed based on the number of qubits
 // This ensures that the seed has sufficient entropy for the required permutations
 func QPPMinimumSeedLength(qubits uint8) int {
+	if int(qubits) < len(minimumSeedLengths) {
+		return minimumSeedLengths[qubits]
+	}
+	return permutationSeedLength(qubits)
+}
+
+// permutationSeedLength computes the byte length of (2^qubits)!, a second for 16 qubits
+func permutationSeedLength(qubits uint8) int {
 	perms := big.NewInt(1 << qubits)
 	for i := 1<<qubits - 1; i > 0; i-- {
 		perms.Mul(perms, big.NewInt(int64(i)))
@@ -328,9 +651,9 @@ func QPPMinimumPads(qubits uint8) int {
 	return minpads
 }
 
-// fill initializes the pad with sequential byte values
+// fill initializes the pad with sequential symbol values
 // This sets up a standard permutation matrix before it is shuffled
-func fill(pad []byte) {
+func fill[T byte | uint16](pad []T) {
 	pad[0] = 0
 	for i := 1; i < len(pad); i++ {
 		pad[i] = pad[i-1] + 1
@@ -339,18 +662,23 @@ func fill(pad []byte) {
 
 // reverse generates the reverse permutation pad from the given pad
 // This allows for efficient decryption by reversing the permutation process
-func reverse(pad []byte, rpad []byte) {
+func reverse[T byte | uint16](pad []T, rpad []T) {
 	for i := range pad {
-		rpad[pad[i]] = byte(i)
+		rpad[pad[i]] = T(i)
 	}
 }
 
 // seedToChunks converts the seed into 32-byte chunks based on the number of qubits
 // This ensures that the seed is sufficiently long and has the required entropy
-func seedToChunks(seed []byte, qubits uint8) [][]byte {
+func seedToChunks(seed []byte, qubits uint8, d derivation) ([][]byte, error) {
 	// Ensure the seed length is at least 32 bytes
 	if len(seed) < 32 {
-		seed = pbkdf2.Key(seed, []byte(CHUNK_DERIVE_SALT), PBKDF2_LOOPS, 32, sha1.New)
+		expanded, err := d.light.Key(seed, d.label(CHUNK_DERIVE_SALT), 32)
+		if err != nil {
+			return nil, err
+		}
+		defer clear(expanded)
+		seed = expanded
 	}
 
 	// Calculate the required byte length for full permutation space
@@ -364,6 +692,17 @@ func seedToChunks(seed []byte, qubits uint8) [][]byte {
 		chunks[i] = make([]byte, 32)
 	}
 
+	// 16-qubit pads take thousands of chunks, so a single heavy KDF call over the
+	// whole seed keys a SHAKE256 expansion of each chunk instead of a call per chunk
+	var expandKey []byte
+	if qubits == 16 {
+		var err error
+		if expandKey, err = d.heavy.Key(seed, d.label(CHUNK_DERIVE_SALT), 32); err != nil {
+			return nil, err
+		}
+		defer clear(expandKey)
+	}
+
 	// Split the seed into overlapping chunks
 	seedIdx := 0
 	for i := range chunks {
@@ -372,22 +711,45 @@ func seedToChunks(seed []byte, qubits uint8) [][]byte {
 			seedIdx++
 		}
 
+		if expandKey != nil {
+			expandChunk(chunks[i], expandKey, i)
+			continue
+		}
+
 		// Perform key expansion
-		derived := pbkdf2.Key(chunks[i], []byte(CHUNK_DERIVE_SALT), CHUNK_DERIVE_LOOPS, len(chunks[i]), sha1.New)
+		derived, err := d.heavy.Key(chunks[i], d.label(CHUNK_DERIVE_SALT), len(chunks[i]))
+		if err != nil {
+			wipeChunks(chunks)
+			return nil, err
+		}
 		copy(chunks[i], derived)
+		clear(derived)
 	}
 
-	return chunks
+	return chunks, nil
+}
+
+// expandChunk replaces a 16-qubit chunk by SHAKE256 of the expansion key, its index and its seed bytes
+func expandChunk(chunk, key []byte, index int) {
+	var idx [4]byte
+	binary.BigEndian.PutUint32(idx[:], uint32(index))
+	h := sha3.NewShake256()
+	h.Write([]byte(CHUNK_EXPAND_IDENTIFIER))
+	h.Write(key)
+	h.Write(idx[:])
+	h.Write(chunk)
+	h.Read(chunk)
 }
 
 // shuffle shuffles the pad based on the seed and pad identifier to create a permutation matrix
-// It uses HMAC and PBKDF2 to derive a unique shuffle pattern from the seed and pad ID
-func shuffle(chunk []byte, pad []byte, padID uint16, blocks []cipher.Block) {
-	// use selected chunk based on pad ID to hmac the PAD_IDENTIFIER
-	message := fmt.Sprintf(PAD_IDENTIFIER, padID)
+// It uses HMAC and PBKDF2 to derive a unique shuffle pattern from the seed, pad identifier and context
+func shuffle(chunk []byte, pad []byte, identifier string, blocks []cipher.Block, context []byte) {
+	// use selected chunk based on pad ID to hmac the pad identifier
 	mac := hmac.New(sha256.New, chunk)
-	mac.Write([]byte(message))
+	mac.Write([]byte(identifier))
+	mac.Write(context)
 	sum := mac.Sum(nil)
+	bigrand := new(big.Int)
 
 	for i := len(pad) - 1; i > 0; i-- {
 		// use all the entropy from the seed to generate a random number
@@ -397,9 +759,20 @@ func shuffle(chunk []byte, pad []byte, padID uint16, blocks []cipher.Block) {
 				block.Encrypt(sum[off:off+aes.BlockSize], sum[off:off+aes.BlockSize])
 			}
 		}
-		bigrand := new(big.Int).SetBytes(sum)
+		bigrand.SetBytes(sum)
 
 		j := bigrand.Mod(bigrand, big.NewInt(int64(i+1))).Uint64()
 		pad[i], pad[j] = pad[j], pad[i]
 	}
+
+	// scrub the shuffle state
+	clear(sum)
+	clear(bigrand.Bits())
+}
+
+// wipeChunks overwrites the seed chunks with zeros
+func wipeChunks(chunks [][]byte) {
+	for _, chunk := range chunks {
+		clear(chunk)
+	}
 }
@@ -341,16 +341,33 @@ func TestEncryptionMixedPRNG(t *testing.T) {
 
 func TestSeedToChunk(t *testing.T) {
 	seed := "hello quantum world, hello quantum world, hello quantum world"
-	t.Log("long seed, 8 qubit:", seedToChunks([]byte(seed), 8))
+	chunks, err := seedToChunks([]byte(seed), 8, v1Derivation)
+	assert.Nil(t, err)
+	t.Log("long seed, 8 qubit:", chunks)
 	shortSeed := "hello"
-	t.Log("short seed, 8 qubit", seedToChunks([]byte(shortSeed), 8))
-	t.Log("chunk size:", len(seedToChunks([]byte(seed), 8)))
+	shortChunks, err := seedToChunks([]byte(shortSeed), 8, v1Derivation)
+	assert.Nil(t, err)
+	t.Log("short seed, 8 qubit", shortChunks)
+	t.Log("chunk size:", len(chunks))
+
+	// 16-qubit chunks are expanded from a single heavy KDF call
+	kdf := &recordingKDF{KDF: v1Derivation.heavy}
+	chunks16, err := seedToChunks([]byte(seed), 16, newDerivation(kdf, nil, PRNG_XOSHIRO))
+	assert.Nil(t, err)
+	assert.Len(t, chunks16, (QPPMinimumSeedLength(16)+31)/32)
+	assert.Len(t, kdf.keys, 1)
+	assert.NotEqual(t, chunks16[0], chunks16[1], "chunks not separated")
 }
 
 func TestQPPMinimumSeedLength(t *testing.T) {
 	for i := 1; i < 16; i++ {
 		t.Log(i, "qubit -> minimum seed length(bytes):", QPPMinimumSeedLength(uint8(i)), "Min Pads:", QPPMinimumPads(uint8(i)))
 	}
+
+	// the table matches the byte length of (2^qubits)!
+	for i, n := range minimumSeedLengths {
+		assert.Equal(t, permutationSeedLength(uint8(i)), n, "%d qubits", i)
+	}
 }
 
 func BenchmarkQPP(b *testing.B) {
@@ -407,3 +424,72 @@ func BenchmarkFastPRNG(b *testing.B) {
 		_ = FastPRNG(seed)
 	}
 }
+
+// padUsageChiSquare counts the pads selected for a stream of xoshiro words and returns the chi-square statistic
+func padUsageChiSquare(ps *PadSet, draws int) float64 {
+	rd := FastPRNG([]byte("pad usage"))
+	freq := make([]int, ps.numPads)
+	for range draws {
+		freq[ps.padOffset(xoshiro256ss(&rd.xoshiro))>>8]++
+	}
+
+	expected := float64(draws) / float64(ps.numPads)
+	chi := 0.0
+	for _, f := range freq {
+		chi += (float64(f) - expected) * (float64(f) - expected) / expected
+	}
+	return chi
+}
+
+func TestUnbiasedPadSelection(t *testing.T) {
+	// 40000 pads: the 16-bit modulo selects pads [0, 25536) twice as often as the rest
+	const numPads = 40000
+	const draws = 100 * numPads
+	biased := &PadSet{numPads: numPads}
+	unbiased := &PadSet{numPads: numPads, unbiased: true}
+
+	// with 39999 degrees of freedom the statistic of a uniform selection is 40000 ± 283
+	biasedChi := padUsageChiSquare(biased, draws)
+	unbiasedChi := padUsageChiSquare(unbiased, draws)
+	t.Logf("pad usage chi-square, biased: %f, unbiased: %f", biasedChi, unbiasedChi)
+	assert.Greater(t, biasedChi, 100000.0, "modulo bias not detected")
+	assert.Less(t, unbiasedChi, 42000.0, "unbiased selection is not uniform")
+
+	// unbiased selection of pads beyond the 16-bit range
+	large := &PadSet{numPads: 100003, unbiased: true}
+	largeChi := padUsageChiSquare(large, 20*100003)
+	t.Logf("pad usage chi-square, 100003 pads: %f", largeChi)
+	assert.Less(t, largeChi, 104000.0, "unbiased selection is not uniform")
+}
+
+func TestMoreThan65535Pads(t *testing.T) {
+	seed := make([]byte, 32)
+	io.ReadFull(rand.Reader, seed)
+
+	_, err := New(seed, &Options{NumPads: 65536})
+	assert.ErrorIs(t, err, ErrInvalidPadCount)
+
+	sender, err := New(seed, &Options{NumPads: 65537, Unbiased: true, Version: PADS_V2})
+	assert.Nil(t, err)
+	receiver, err := New(seed, &Options{NumPads: 65537, Unbiased: true, Version: PADS_V2})
+	assert.Nil(t, err)
+
+	original := make([]byte, 65536)
+	io.ReadFull(rand.Reader, original)
+	msg := make([]byte, len(original))
+	copy(msg, original)
+
+	// odd chunk lengths exercise the unaligned, unrolled and tail paths
+	for start := msg; len(start) > 0; {
+		l := min(len(start), mathrand.Intn(37))
+		sender.Encrypt(start[:l])
+		start = start[l:]
+	}
+	assert.NotEqual(t, original, msg, "not encrypted")
+	for start := msg; len(start) > 0; {
+		l := min(len(start), mathrand.Intn(41))
+		receiver.Decrypt(start[:l])
+		start = start[l:]
+	}
+	assert.Equal(t, original, msg, "not equal")
+}
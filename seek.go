@@ -0,0 +1,190 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+import (
+	"fmt"
+	"math/bits"
+	"sync"
+)
+
+// xoshiroCharPoly returns the low 256 bits of the characteristic polynomial of the
+// xoshiro256 transition, x^256 being implicit. It is recovered once with
+// Berlekamp-Massey from a bit of the state sequence, whose minimal polynomial is
+// the characteristic polynomial since the generator has full period.
+var xoshiroCharPoly = sync.OnceValue(func() [4]uint64 {
+	const n = 512
+	var seq [n]uint8
+	s := [4]uint64{1, 2, 3, 4}
+	for i := range seq {
+		seq[i] = uint8(s[0] & 1)
+		xoshiro256ss(&s)
+	}
+
+	c, l := berlekampMassey(seq[:])
+	if l != 256 {
+		panic(fmt.Sprintf("qpp: xoshiro256 linear complexity %d, expected 256", l))
+	}
+
+	// P(x) = x^L + c1 x^(L-1) + ... + cL
+	var p [4]uint64
+	for i := 1; i <= l; i++ {
+		if c[i] == 1 {
+			e := l - i
+			p[e/64] |= 1 << (e % 64)
+		}
+	}
+	return p
+})
+
+// berlekampMassey returns the connection polynomial C and the linear complexity L of a
+// binary sequence, so that s[i] = c[1]s[i-1] ^ ... ^ c[L]s[i-L].
+func berlekampMassey(s []uint8) ([]uint8, int) {
+	n := len(s)
+	c := make([]uint8, n+1)
+	b := make([]uint8, n+1)
+	c[0], b[0] = 1, 1
+	l, m := 0, 1
+	for i := 0; i < n; i++ {
+		d := s[i]
+		for j := 1; j <= l; j++ {
+			d ^= c[j] & s[i-j]
+		}
+		if d == 0 {
+			m++
+			continue
+		}
+
+		t := append([]uint8(nil), c...)
+		for j := 0; j+m <= n; j++ {
+			c[j+m] ^= b[j]
+		}
+		if 2*l <= i {
+			l = i + 1 - l
+			b = t
+			m = 1
+		} else {
+			m++
+		}
+	}
+	return c, l
+}
+
+// polyMulX multiplies the polynomial a by x modulo the characteristic polynomial
+func polyMulX(a [4]uint64, p *[4]uint64) [4]uint64 {
+	carry := a[3] >> 63
+	a[3] = a[3]<<1 | a[2]>>63
+	a[2] = a[2]<<1 | a[1]>>63
+	a[1] = a[1]<<1 | a[0]>>63
+	a[0] = a[0] << 1
+	if carry != 0 {
+		a[0] ^= p[0]
+		a[1] ^= p[1]
+		a[2] ^= p[2]
+		a[3] ^= p[3]
+	}
+	return a
+}
+
+// polyMulMod multiplies the polynomials a and b modulo the characteristic polynomial
+func polyMulMod(a, b [4]uint64, p *[4]uint64) [4]uint64 {
+	var r [4]uint64
+	for i := 255; i >= 0; i-- {
+		r = polyMulX(r, p)
+		if b[i/64]&(1<<(i%64)) != 0 {
+			r[0] ^= a[0]
+			r[1] ^= a[1]
+			r[2] ^= a[2]
+			r[3] ^= a[3]
+		}
+	}
+	return r
+}
+
+// jumpPoly returns the jump polynomial x^k modulo the characteristic polynomial,
+// which advances the state by k words through xoshiroJumpState.
+func jumpPoly(k uint64) [4]uint64 {
+	p := xoshiroCharPoly()
+	r := [4]uint64{1}
+	for i := bits.Len64(k) - 1; i >= 0; i-- {
+		r = polyMulMod(r, r, &p)
+		if k&(1<<i) != 0 {
+			r = polyMulX(r, &p)
+		}
+	}
+	return r
+}
+
+// Seek positions the PRNG at byteOffset of the stream it started with or last jumped to, as seen by
+// 8-qubit pads switched every PAD_SWITCH bytes. The state is moved with a jump
+// polynomial, or the block counter of a CSPRNG keystream, so seeking costs the same
+// for any offset.
+func (r *Rand) Seek(byteOffset uint64) {
+	r.seek(byteOffset/PAD_SWITCH, byteOffset%PAD_SWITCH)
+}
+
+// seek sets the current word to the given word of the stream with count symbols consumed
+func (r *Rand) seek(words, count uint64) {
+	if r.destroyed {
+		panic(ErrDestroyed)
+	}
+	if r.keystream != nil {
+		if err := r.keystream.seek(words); err != nil {
+			panic(err)
+		}
+		r.seed64 = r.keystream.uint64()
+		r.count = uint8(count)
+		return
+	}
+
+	s := r.origin
+	if words > 0 {
+		poly := jumpPoly(words)
+		xoshiroJumpState(&s, &poly)
+	}
+	r.xoshiro = s
+	r.seed64 = xoshiro256ss(&r.xoshiro)
+	r.count = uint8(count)
+}
+
+// seekTo positions a copy of rand at byteOffset for the geometry of the pad set
+func (ps *PadSet) seekTo(rand *Rand, byteOffset uint64) *Rand {
+	symbols := byteOffset * 8 / uint64(ps.qubits)
+	if ps.qubits == 16 && byteOffset%2 != 0 {
+		panic(fmt.Sprintf("qpp: offset %d is not a multiple of the 16-qubit symbol size", byteOffset))
+	}
+	r := &Rand{origin: rand.origin, destroyed: rand.destroyed}
+	if rand.keystream != nil {
+		// the keystream of rand may be in use, restart a copy of it
+		r.keystream = &keystream{key: rand.keystream.key, prng: rand.keystream.prng}
+	}
+	r.seek(symbols/uint64(ps.padSwitch), symbols%uint64(ps.padSwitch))
+	return r
+}
+
+// EncryptAt encrypts data as the part of the stream starting at byteOffset, counted from the
+// start of the encryption PRNG. The PRNG of the session is not advanced, so EncryptAt may be
+// called concurrently with other EncryptAt and DecryptAt calls.
+func (s *Session) EncryptAt(data []byte, byteOffset uint64) {
+	s.EncryptWithPRNG(data, s.seekTo(s.encRand, byteOffset))
+}
+
+// DecryptAt decrypts data taken at byteOffset of a stream encrypted from the start of the
+// decryption PRNG, e.g. to serve a range request on an encrypted blob.
+// The PRNG of the session is not advanced.
+func (s *Session) DecryptAt(data []byte, byteOffset uint64) {
+	s.DecryptWithPRNG(data, s.seekTo(s.decRand, byteOffset))
+}
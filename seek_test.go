@@ -0,0 +1,149 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+import (
+	"crypto/rand"
+	"io"
+	"math"
+	mathrand "math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJumpPoly(t *testing.T) {
+	// x^(2^128) and x^(2^192) must give the reference jump polynomials
+	p := xoshiroCharPoly()
+	x := [4]uint64{2}
+	for i := range 192 {
+		x = polyMulMod(x, x, &p)
+		if i == 127 {
+			assert.Equal(t, xoshiroJump, x, "jump polynomial")
+		}
+	}
+	assert.Equal(t, xoshiroLongJump, x, "long jump polynomial")
+
+	// small jumps agree with stepping
+	for _, k := range []uint64{1, 2, 255, 256, 1000} {
+		s := [4]uint64{1, 2, 3, 4}
+		expected := s
+		for range k {
+			xoshiro256ss(&expected)
+		}
+		poly := jumpPoly(k)
+		xoshiroJumpState(&s, &poly)
+		assert.Equal(t, expected, s, "jump by %d", k)
+	}
+}
+
+func TestSeek(t *testing.T) {
+	seed := make([]byte, 32)
+	io.ReadFull(rand.Reader, seed)
+
+	// Seek matches a Rand that encrypted offset bytes
+	qpp := NewQPP(seed, 977)
+	for _, offset := range []uint64{0, 1, 7, 8, 9, 4097} {
+		sequential := CreatePRNG(seed)
+		qpp.EncryptWithPRNG(make([]byte, offset), sequential)
+		sought := CreatePRNG(seed)
+		sought.Seek(offset)
+		assert.Equal(t, *sequential, *sought, "seek to %d", offset)
+	}
+
+	for _, opts := range []Options{
+		{NumPads: 977},
+		{NumPads: 31, Qubits: 4, PadSwitch: 5},
+		{NumPads: 3, Qubits: 16, PadSwitch: 7, KDF: HKDF{}},
+		{NumPads: 977, PRNG: PRNG_CHACHA20},
+		{NumPads: 31, Qubits: 4, PadSwitch: 5, PRNG: PRNG_AES_CTR},
+	} {
+		qpp, err := New(seed, &opts)
+		assert.Nil(t, err)
+
+		original := make([]byte, 65536)
+		io.ReadFull(rand.Reader, original)
+		ciphertext := append([]byte(nil), original...)
+		qpp.Encrypt(ciphertext)
+
+		for range 100 {
+			start := mathrand.Intn(len(original))
+			end := start + mathrand.Intn(len(original)-start+1)
+			if opts.Qubits == 16 {
+				start, end = start&^1, end&^1
+			}
+
+			part := append([]byte{}, ciphertext[start:end]...)
+			qpp.DecryptAt(part, uint64(start))
+			assert.Equal(t, original[start:end], part, "DecryptAt %d", start)
+
+			part = append(part[:0], original[start:end]...)
+			qpp.EncryptAt(part, uint64(start))
+			assert.Equal(t, ciphertext[start:end], part, "EncryptAt %d", start)
+		}
+
+		// the session PRNGs are not advanced
+		qpp.Decrypt(ciphertext)
+		assert.Equal(t, original, ciphertext, "not equal")
+	}
+
+}
+
+func TestSeekKeystream(t *testing.T) {
+	seed := []byte("seek keystream")
+	qpp := NewQPP(seed, 7)
+	for _, prng := range []int{PRNG_CHACHA20, PRNG_AES_CTR} {
+		// offsets within, at the end of and across the 512-byte keystream chunks
+		for _, offset := range []uint64{0, 1, 8, 9, 4095, 4096, 4097, 100003} {
+			sequential := FastPRNGWith(seed, prng)
+			qpp.EncryptWithPRNG(make([]byte, offset), sequential)
+			sought := FastPRNGWith(seed, prng)
+			sought.Seek(offset)
+			r, count := sequential.State()
+			assert.Equal(t, r, sought.seed64, "seek to %d", offset)
+			assert.Equal(t, count, sought.count, "seek to %d", offset)
+			for range 100 {
+				assert.Equal(t, sequential.Uint64(), sought.Uint64(), "seek to %d", offset)
+			}
+		}
+	}
+
+	// the block counters carry into the IV of AES-CTR and the nonce of ChaCha20
+	for _, prng := range []int{PRNG_CHACHA20, PRNG_AES_CTR} {
+		FastPRNGWith(seed, prng).Seek(math.MaxUint64)
+	}
+
+	// ChaCha20 goes on past 2^32 blocks without repeating its first blocks
+	wrap := uint64(chachaChunks) * 512 / 8
+	before, after := FastPRNGWith(seed, PRNG_CHACHA20), FastPRNGWith(seed, PRNG_CHACHA20)
+	before.Seek((wrap - 8) * PAD_SWITCH)
+	after.Seek(wrap * PAD_SWITCH)
+	for range 7 {
+		before.Uint64()
+	}
+	word, _ := after.State()
+	assert.Equal(t, word, before.Uint64(), "stream broken at the counter wrap")
+	assert.Equal(t, after.Uint64(), before.Uint64(), "stream broken at the counter wrap")
+	start, _ := FastPRNGWith(seed, PRNG_CHACHA20).State()
+	assert.NotEqual(t, start, word, "stream repeated at the counter wrap")
+}
+
+func BenchmarkSeek(b *testing.B) {
+	rand := FastPRNG([]byte("seed"))
+	for i := 0; i < b.N; i++ {
+		rand.Seek(uint64(i) << 32)
+	}
+}
@@ -0,0 +1,65 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+// Selector is a source of the 64-bit words that select the pads and mask the symbols
+// Every PadSwitch symbols a new word is drawn with Uint64, State and SetState carry the
+// current word and the number of symbols consumed from it across calls, so encrypting
+// a message in pieces gives the same result as encrypting it at once.
+// A new Selector must hold its first word with count 0, as CreatePRNG does for Rand.
+type Selector interface {
+	Uint64() uint64                    // next word of the stream
+	State() (word uint64, count uint8) // current word and symbols consumed from it
+	SetState(word uint64, count uint8) // store the current word and count back
+}
+
+// Uint64 returns the next word of xoshiro256** or of the CSPRNG keystream
+func (r *Rand) Uint64() uint64 {
+	return r.next()
+}
+
+// State returns the current word and the number of symbols consumed from it
+func (r *Rand) State() (uint64, uint8) {
+	return r.seed64, r.count
+}
+
+// SetState sets the current word and the number of symbols consumed from it
+func (r *Rand) SetState(word uint64, count uint8) {
+	r.seed64 = word
+	r.count = count
+}
+
+// EncryptWithSelector encrypts the data with the pad selection and masks drawn from sel
+// The built-in Rand keeps the unrolled paths of EncryptWithPRNG, other selectors go
+// through the generic symbol path, which produces the same stream.
+func (ps *PadSet) EncryptWithSelector(data []byte, sel Selector) {
+	if rand, ok := sel.(*Rand); ok {
+		ps.EncryptWithPRNG(data, rand)
+		return
+	}
+	ps.checkAlive(nil)
+	ps.cryptSymbols(data, sel, false)
+}
+
+// DecryptWithSelector decrypts the data with the pad selection and masks drawn from sel
+func (ps *PadSet) DecryptWithSelector(data []byte, sel Selector) {
+	if rand, ok := sel.(*Rand); ok {
+		ps.DecryptWithPRNG(data, rand)
+		return
+	}
+	ps.checkAlive(nil)
+	ps.cryptSymbols(data, sel, true)
+}
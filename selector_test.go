@@ -0,0 +1,108 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/sha3"
+)
+
+// opaqueSelector hides the Rand type so that the generic symbol path is taken
+type opaqueSelector struct{ *Rand }
+
+// shakeSelector draws its words from a SHAKE256 stream
+type shakeSelector struct {
+	shake sha3.ShakeHash
+	word  uint64
+	count uint8
+}
+
+func newShakeSelector(seed []byte) *shakeSelector {
+	s := &shakeSelector{shake: sha3.NewShake256()}
+	s.shake.Write(seed)
+	s.word = s.Uint64()
+	return s
+}
+
+func (s *shakeSelector) Uint64() uint64 {
+	var b [8]byte
+	s.shake.Read(b[:])
+	return binary.LittleEndian.Uint64(b[:])
+}
+
+func (s *shakeSelector) State() (uint64, uint8)            { return s.word, s.count }
+func (s *shakeSelector) SetState(word uint64, count uint8) { s.word, s.count = word, count }
+
+func TestSelectorMatchesRand(t *testing.T) {
+	seed := make([]byte, 32)
+	io.ReadFull(rand.Reader, seed)
+
+	for _, opts := range []Options{{NumPads: 977}, {NumPads: 31, Qubits: 4, PadSwitch: 5}} {
+		ps, err := NewPadSet(seed, &opts)
+		assert.Nil(t, err)
+
+		original := make([]byte, 65536)
+		io.ReadFull(rand.Reader, original)
+		expected := append([]byte(nil), original...)
+		msg := append([]byte(nil), original...)
+
+		r1, r2 := FastPRNG(seed), FastPRNG(seed)
+		encryptChunked(expected, 29, 1, func(b []byte) { ps.EncryptWithPRNG(b, r1) })
+		encryptChunked(msg, 31, 1, func(b []byte) { ps.EncryptWithSelector(b, opaqueSelector{r2}) })
+		assert.Equal(t, expected, msg, "selector path disagrees with Rand")
+		assert.Equal(t, r1, r2, "PRNG states differ")
+
+		r2 = FastPRNG(seed)
+		encryptChunked(msg, 13, 1, func(b []byte) { ps.DecryptWithSelector(b, r2) })
+		assert.Equal(t, original, msg, "not equal")
+	}
+}
+
+func TestCustomSelector(t *testing.T) {
+	seed := make([]byte, 32)
+	io.ReadFull(rand.Reader, seed)
+	qpp := NewQPP(seed, 977)
+
+	original := make([]byte, 4096)
+	io.ReadFull(rand.Reader, original)
+	msg := append([]byte(nil), original...)
+
+	encryptChunked(msg, 100, 1, func(b []byte) { qpp.EncryptWithSelector(b, newShakeSelector(seed)) })
+	assert.NotEqual(t, original, msg)
+
+	msg = append([]byte(nil), original...)
+	enc, dec := newShakeSelector(seed), newShakeSelector(seed)
+	encryptChunked(msg, 100, 1, func(b []byte) { qpp.EncryptWithSelector(b, enc) })
+	encryptChunked(msg, 77, 1, func(b []byte) { qpp.DecryptWithSelector(b, dec) })
+	assert.Equal(t, original, msg, "not equal")
+}
+
+func BenchmarkEncryptWithSelector(b *testing.B) {
+	seed := make([]byte, 32)
+	io.ReadFull(rand.Reader, seed)
+	qpp := NewQPP(seed, 977)
+	sel := newShakeSelector(seed)
+	msg := make([]byte, 65536)
+	b.SetBytes(int64(len(msg)))
+	for i := 0; i < b.N; i++ {
+		qpp.EncryptWithSelector(msg, sel)
+	}
+}
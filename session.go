@@ -0,0 +1,42 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+// Session binds a shared PadSet to its own PRNGs for encryption and decryption
+// Sessions are lightweight, thousands of them can share one PadSet, but a single
+// Session is not safe for concurrent use since encryption advances its PRNGs.
+type Session struct {
+	*PadSet
+	encRand *Rand // Random source for encryption pad selection
+	decRand *Rand // Random source for decryption pad selection
+}
+
+// NewSession creates a session encrypting with encRand and decrypting with decRand over the given pad set
+func NewSession(ps *PadSet, encRand, decRand *Rand) *Session {
+	return &Session{PadSet: ps, encRand: encRand, decRand: decRand}
+}
+
+// Encrypt encrypts the given data using the Quantum Permutation Pad with the session's encryption PRNG
+// It selects a permutation matrix based on a random index and uses it to permute each byte of the data
+func (s *Session) Encrypt(data []byte) {
+	s.EncryptWithPRNG(data, s.encRand)
+}
+
+// Decrypt decrypts the given data using the Quantum Permutation Pad with the session's decryption PRNG
+// It selects a reverse permutation matrix based on a random index and uses it to restore each byte of the data
+func (s *Session) Decrypt(data []byte) {
+	s.DecryptWithPRNG(data, s.decRand)
+}
@@ -0,0 +1,86 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+import (
+	"crypto/rand"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionMatchesQPP(t *testing.T) {
+	seed := make([]byte, 32)
+	io.ReadFull(rand.Reader, seed)
+
+	qpp := NewQPP(seed, 31)
+	ps, err := NewPadSet(seed, &Options{NumPads: 31})
+	assert.Nil(t, err)
+	assert.Equal(t, qpp.pads, ps.pads)
+
+	session := NewSession(ps, ps.CreatePRNG(seed), ps.CreatePRNG(seed))
+
+	original := make([]byte, 4096)
+	io.ReadFull(rand.Reader, original)
+	expected := make([]byte, len(original))
+	copy(expected, original)
+	msg := make([]byte, len(original))
+	copy(msg, original)
+
+	qpp.Encrypt(expected)
+	session.Encrypt(msg)
+	assert.Equal(t, expected, msg, "session and qpp disagree")
+	session.Decrypt(msg)
+	assert.Equal(t, original, msg, "not equal")
+}
+
+func TestSessionsShareImmutablePadSet(t *testing.T) {
+	seed := make([]byte, 32)
+	io.ReadFull(rand.Reader, seed)
+
+	ps, err := NewPadSet(seed, &Options{NumPads: 31})
+	assert.Nil(t, err)
+	pads := append([]byte(nil), ps.pads...)
+	rpads := append([]byte(nil), ps.rpads...)
+
+	var wg sync.WaitGroup
+	for i := range 64 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			prngSeed := []byte{byte(i)}
+			sender := NewSession(ps, FastPRNG(prngSeed), nil)
+			receiver := NewSession(ps, nil, FastPRNG(prngSeed))
+
+			original := make([]byte, 1500)
+			io.ReadFull(rand.Reader, original)
+			msg := make([]byte, len(original))
+			copy(msg, original)
+
+			for range 16 {
+				sender.Encrypt(msg)
+				receiver.Decrypt(msg)
+				assert.Equal(t, original, msg, "not equal")
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, pads, ps.pads, "pads modified")
+	assert.Equal(t, rpads, ps.rpads, "rpads modified")
+}
@@ -0,0 +1,93 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+import (
+	"encoding/binary"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// Pad derivation algorithms
+const (
+	PADS_V1 = 1 // Fisher-Yates driven by AES rounds over all chunks and big.Int modulus
+	PADS_V2 = 2 // Fisher-Yates driven by a SHAKE256 stream with rejection sampling
+
+	SHUFFLE_V2_IDENTIFIER   = "___QUANTUM_PERMUTATION_PAD_SHUFFLE_V2___"
+	CHUNK_EXPAND_IDENTIFIER = "___QUANTUM_PERMUTATION_PAD_CHUNK_EXPAND___"
+)
+
+// shakeStream draws unbiased random numbers from a SHAKE256 output stream
+type shakeStream struct {
+	shake sha3.ShakeHash
+	buf   [512]byte
+	off   int
+}
+
+// newShakeStream absorbs the seed chunks, pad identifier and context of a pad into SHAKE256
+// Every chunk is absorbed so that each pad depends on the full entropy of the seed.
+func newShakeStream(chunks [][]byte, identifier string, context []byte) *shakeStream {
+	s := &shakeStream{shake: sha3.NewShake256()}
+	s.shake.Write([]byte(SHUFFLE_V2_IDENTIFIER))
+	for _, chunk := range chunks {
+		s.shake.Write(chunk)
+	}
+	s.shake.Write([]byte(identifier))
+	s.shake.Write(context)
+	s.off = len(s.buf)
+	return s
+}
+
+// uint32 returns the next 32-bit word of the stream
+func (s *shakeStream) uint32() uint32 {
+	if s.off == len(s.buf) {
+		s.shake.Read(s.buf[:])
+		s.off = 0
+	}
+	x := binary.LittleEndian.Uint32(s.buf[s.off:])
+	s.off += 4
+	return x
+}
+
+// uniform returns an unbiased random number in [0, bound) with Lemire's
+// multiply-shift method, words falling into the biased range are rejected.
+func (s *shakeStream) uniform(bound uint32) uint32 {
+	threshold := -bound % bound
+	for {
+		m := uint64(s.uint32()) * uint64(bound)
+		if uint32(m) >= threshold {
+			return uint32(m >> 32)
+		}
+	}
+}
+
+// shuffleV2 shuffles the pad with Fisher-Yates, drawing the swap indices from a
+// SHAKE256 stream, it involves no AES rounds and no big-number arithmetic.
+func shuffleV2[T byte | uint16](chunks [][]byte, pad []T, identifier string, context []byte) {
+	s := newShakeStream(chunks, identifier, context)
+	for i := len(pad) - 1; i > 0; i-- {
+		j := s.uniform(uint32(i + 1))
+		pad[i], pad[j] = pad[j], pad[i]
+	}
+	s.wipe()
+}
+
+// wipe discards the sponge state and the buffered output
+func (s *shakeStream) wipe() {
+	s.shake.Reset()
+	clear(s.buf[:])
+	s.off = len(s.buf)
+}
@@ -0,0 +1,87 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+import (
+	"crypto/rand"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPadsV2(t *testing.T) {
+	seed := make([]byte, 32)
+	io.ReadFull(rand.Reader, seed)
+
+	v1, err := New(seed, &Options{NumPads: 31})
+	assert.Nil(t, err)
+	explicitV1, err := New(seed, &Options{NumPads: 31, Version: PADS_V1})
+	assert.Nil(t, err)
+	v2, err := New(seed, &Options{NumPads: 31, Version: PADS_V2})
+	assert.Nil(t, err)
+	again, err := New(seed, &Options{NumPads: 31, Version: PADS_V2})
+	assert.Nil(t, err)
+
+	assert.Equal(t, v1.pads, explicitV1.pads, "v1 must stay the default")
+	assert.NotEqual(t, v1.pads, v2.pads, "v2 must differ from v1")
+	assert.Equal(t, v2.pads, again.pads, "v2 not deterministic")
+
+	matrixBytes := 1 << QUBITS
+	for i := 0; i < 31; i++ {
+		pad := v2.pads[i*matrixBytes : (i+1)*matrixBytes]
+		rpad := v2.rpads[i*matrixBytes : (i+1)*matrixBytes]
+		for j := range matrixBytes {
+			assert.Equal(t, rpad[pad[j]], byte(j), "not reversible")
+		}
+	}
+
+	original := make([]byte, 4096)
+	io.ReadFull(rand.Reader, original)
+	msg := make([]byte, len(original))
+	copy(msg, original)
+	v2.Encrypt(msg)
+	assert.NotEqual(t, original, msg, "not encrypted")
+	again.Decrypt(msg)
+	assert.Equal(t, original, msg, "not equal")
+}
+
+func TestShakeStreamUniform(t *testing.T) {
+	s := newShakeStream([][]byte{[]byte("chunk")}, padIdentifier(0, 0), nil)
+	counts := make([]int, 7)
+	for range 70000 {
+		counts[s.uniform(7)]++
+	}
+	for i, c := range counts {
+		assert.InDelta(t, 10000, c, 500, "value %d drawn %d times", i, c)
+	}
+}
+
+func BenchmarkNewV1(b *testing.B) {
+	benchmarkNewVersion(b, PADS_V1)
+}
+
+func BenchmarkNewV2(b *testing.B) {
+	benchmarkNewVersion(b, PADS_V2)
+}
+
+func benchmarkNewVersion(b *testing.B, version int) {
+	seed := make([]byte, 32)
+	io.ReadFull(rand.Reader, seed)
+	for i := 0; i < b.N; i++ {
+		_, _ = New(seed, &Options{NumPads: 977, Version: version})
+	}
+}
@@ -0,0 +1,181 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Rand snapshot encoding
+const (
+	SNAPSHOT_VERSION = 1                   // version of the Rand snapshot encoding
+	SNAPSHOT_SIZE    = 2 + 32 + 32 + 8 + 1 // version, algorithm, xoshiro or key, origin or position, seed64, count
+	SNAPSHOT_AD      = "___QUANTUM_PERMUTATION_PAD_RAND_SNAPSHOT___"
+)
+
+// ErrInvalidSnapshot is returned when restoring the state of a Rand from a malformed snapshot
+var ErrInvalidSnapshot = errors.New("qpp: invalid PRNG snapshot")
+
+// MarshalBinary encodes the state of the PRNG, so that a stream can be resumed
+// after a restart with UnmarshalBinary. The snapshot holds key material, use
+// MarshalSealed to store it outside of trusted memory.
+// A CSPRNG keystream is stored as its key and the number of words drawn from it.
+func (r *Rand) MarshalBinary() ([]byte, error) {
+	if r.destroyed {
+		return nil, ErrDestroyed
+	}
+
+	b := make([]byte, 0, SNAPSHOT_SIZE)
+	if ks := r.keystream; ks != nil {
+		b = append(b, SNAPSHOT_VERSION, byte(ks.prng))
+		b = append(b, ks.key[:]...)
+		b = binary.LittleEndian.AppendUint64(b, ks.position())
+		b = append(b, make([]byte, 24)...)
+	} else {
+		b = append(b, SNAPSHOT_VERSION, PRNG_XOSHIRO)
+		for _, s := range r.xoshiro {
+			b = binary.LittleEndian.AppendUint64(b, s)
+		}
+		for _, s := range r.origin {
+			b = binary.LittleEndian.AppendUint64(b, s)
+		}
+	}
+	b = binary.LittleEndian.AppendUint64(b, r.seed64)
+	b = append(b, r.count)
+	return b, nil
+}
+
+// UnmarshalBinary restores the state of the PRNG from a snapshot made by MarshalBinary
+// The snapshot does not record the pad set, its count of symbols is only checked against
+// the largest PadSwitch, so the caller must resume the stream with a pad set of the
+// same PadSwitch, whose interval is always above the count it saved.
+func (r *Rand) UnmarshalBinary(data []byte) error {
+	if len(data) != SNAPSHOT_SIZE {
+		return fmt.Errorf("%w: length %d, expected %d", ErrInvalidSnapshot, len(data), SNAPSHOT_SIZE)
+	}
+	if data[0] != SNAPSHOT_VERSION {
+		return fmt.Errorf("%w: version %d", ErrInvalidSnapshot, data[0])
+	}
+
+	// a pad is switched after at most 255 symbols, so the count stays below that
+	if data[74] >= 0xFF {
+		return fmt.Errorf("%w: count %d", ErrInvalidSnapshot, data[74])
+	}
+
+	var rd Rand
+	rd.seed64 = binary.LittleEndian.Uint64(data[66:])
+	rd.count = data[74]
+	switch data[1] {
+	case PRNG_XOSHIRO:
+	case PRNG_CHACHA20, PRNG_AES_CTR:
+		return r.unmarshalKeystream(data, rd)
+	default:
+		return fmt.Errorf("%w: PRNG algorithm %d", ErrInvalidSnapshot, data[1])
+	}
+
+	off := 2
+	for i := range rd.xoshiro {
+		rd.xoshiro[i] = binary.LittleEndian.Uint64(data[off:])
+		off += 8
+	}
+	for i := range rd.origin {
+		rd.origin[i] = binary.LittleEndian.Uint64(data[off:])
+		off += 8
+	}
+
+	// xoshiro256** never leaves the all-zero state once in it
+	if rd.xoshiro == [4]uint64{} || rd.origin == [4]uint64{} {
+		return fmt.Errorf("%w: zero state", ErrInvalidSnapshot)
+	}
+	*r = rd
+	return nil
+}
+
+// unmarshalKeystream restores a CSPRNG keystream at the position recorded in the snapshot
+func (r *Rand) unmarshalKeystream(data []byte, rd Rand) error {
+	for _, b := range data[42:66] {
+		if b != 0 {
+			return fmt.Errorf("%w: nonzero padding", ErrInvalidSnapshot)
+		}
+	}
+
+	ks, err := newKeystream(data[2:34], int(data[1]))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	position := binary.LittleEndian.Uint64(data[34:])
+	if err := ks.seek(position); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	rd.keystream = ks
+	*r = rd
+	return nil
+}
+
+// MarshalSealed encodes the state of the PRNG like MarshalBinary, and seals it with
+// AES-GCM under key, which must be 16, 24 or 32 bytes long.
+func (r *Rand) MarshalSealed(key []byte) ([]byte, error) {
+	aead, err := newSnapshotAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := r.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	defer clear(plaintext)
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, []byte(SNAPSHOT_AD)), nil
+}
+
+// UnmarshalSealed restores the state of the PRNG from a snapshot made by MarshalSealed
+// Snapshots that were sealed under another key or modified are rejected with ErrInvalidSnapshot.
+func (r *Rand) UnmarshalSealed(key, sealed []byte) error {
+	aead, err := newSnapshotAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	if len(sealed) < aead.NonceSize()+aead.Overhead() {
+		return fmt.Errorf("%w: sealed length %d", ErrInvalidSnapshot, len(sealed))
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(SNAPSHOT_AD))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	defer clear(plaintext)
+	return r.UnmarshalBinary(plaintext)
+}
+
+// newSnapshotAEAD creates the AES-GCM instance sealing snapshots
+func newSnapshotAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("qpp: invalid snapshot key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,146 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+import (
+	"crypto/rand"
+	"encoding"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	_ encoding.BinaryMarshaler   = (*Rand)(nil)
+	_ encoding.BinaryUnmarshaler = (*Rand)(nil)
+)
+
+func TestSnapshot(t *testing.T) {
+	seed := make([]byte, 32)
+	io.ReadFull(rand.Reader, seed)
+	qpp := NewQPP(seed, 977)
+
+	original := make([]byte, 4096)
+	io.ReadFull(rand.Reader, original)
+	expected := append([]byte(nil), original...)
+	qpp.EncryptWithPRNG(expected, CreatePRNG(seed))
+
+	// encrypt an odd-sized first chunk, checkpoint, and resume in a new Rand
+	msg := append([]byte(nil), original...)
+	r := CreatePRNG(seed)
+	qpp.EncryptWithPRNG(msg[:1001], r)
+	snapshot, err := r.MarshalBinary()
+	assert.Nil(t, err)
+	assert.Len(t, snapshot, SNAPSHOT_SIZE)
+
+	var resumed Rand
+	assert.Nil(t, resumed.UnmarshalBinary(snapshot))
+	assert.Equal(t, *r, resumed)
+	qpp.EncryptWithPRNG(msg[1001:], &resumed)
+	assert.Equal(t, expected, msg, "resumed stream differs")
+
+	// the origin survives, so a restored Rand can still seek
+	resumed.Seek(1001)
+	assert.Equal(t, *r, resumed)
+
+	// corrupted snapshots are rejected
+	for _, bad := range [][]byte{
+		nil,
+		snapshot[:SNAPSHOT_SIZE-1],
+		append(append([]byte(nil), snapshot...), 0),
+		append([]byte{SNAPSHOT_VERSION + 1}, snapshot[1:]...),
+		append([]byte{SNAPSHOT_VERSION, PRNG_CHACHA20}, snapshot[2:]...),
+		append([]byte{SNAPSHOT_VERSION, PRNG_XOSHIRO}, make([]byte, SNAPSHOT_SIZE-2)...),
+	} {
+		assert.ErrorIs(t, resumed.UnmarshalBinary(bad), ErrInvalidSnapshot)
+	}
+
+	r.Destroy()
+	_, err = r.MarshalBinary()
+	assert.ErrorIs(t, err, ErrDestroyed)
+}
+
+func TestSnapshotKeystream(t *testing.T) {
+	seed := []byte("snapshot keystream")
+	qpp := NewQPP(seed, 977)
+	for _, prng := range []int{PRNG_CHACHA20, PRNG_AES_CTR} {
+		original := make([]byte, 10000)
+		io.ReadFull(rand.Reader, original)
+		expected := append([]byte(nil), original...)
+		qpp.EncryptWithPRNG(expected, FastPRNGWith(seed, prng))
+
+		// checkpoint within and at the end of a keystream chunk
+		for _, split := range []int{1001, 4096} {
+			msg := append([]byte(nil), original...)
+			r := FastPRNGWith(seed, prng)
+			qpp.EncryptWithPRNG(msg[:split], r)
+			snapshot, err := r.MarshalBinary()
+			assert.Nil(t, err)
+			assert.Len(t, snapshot, SNAPSHOT_SIZE)
+
+			var resumed Rand
+			assert.Nil(t, resumed.UnmarshalBinary(snapshot))
+			qpp.EncryptWithPRNG(msg[split:], &resumed)
+			assert.Equal(t, expected, msg, "resumed stream differs")
+		}
+	}
+
+	// a nonzero padding is rejected, any position of the keystream is accepted
+	snapshot, err := FastPRNGWith(seed, PRNG_CHACHA20).MarshalBinary()
+	assert.Nil(t, err)
+	var resumed Rand
+	bad := append([]byte(nil), snapshot...)
+	bad[50] = 1
+	assert.ErrorIs(t, resumed.UnmarshalBinary(bad), ErrInvalidSnapshot)
+	far := append([]byte(nil), snapshot...)
+	far[41] = 0xFF
+	assert.Nil(t, resumed.UnmarshalBinary(far))
+
+	// no pad switch interval leaves 255 symbols of a word consumed
+	bad = append([]byte(nil), snapshot...)
+	bad[74] = 0xFF
+	assert.ErrorIs(t, resumed.UnmarshalBinary(bad), ErrInvalidSnapshot)
+	bad[74] = 0xFE
+	assert.Nil(t, resumed.UnmarshalBinary(bad))
+}
+
+func TestSealedSnapshot(t *testing.T) {
+	key := make([]byte, 32)
+	io.ReadFull(rand.Reader, key)
+	r := FastPRNG([]byte("seed"))
+	r.Seek(12345)
+
+	sealed, err := r.MarshalSealed(key)
+	assert.Nil(t, err)
+	plain, _ := r.MarshalBinary()
+	assert.NotContains(t, string(sealed), string(plain[2:34]), "state leaked into the sealed snapshot")
+
+	var restored Rand
+	assert.Nil(t, restored.UnmarshalSealed(key, sealed))
+	assert.Equal(t, *r, restored)
+
+	// tampering and wrong keys are detected
+	sealed[len(sealed)/2] ^= 1
+	assert.ErrorIs(t, restored.UnmarshalSealed(key, sealed), ErrInvalidSnapshot)
+	sealed[len(sealed)/2] ^= 1
+	otherKey := make([]byte, 32)
+	assert.ErrorIs(t, restored.UnmarshalSealed(otherKey, sealed), ErrInvalidSnapshot)
+	assert.ErrorIs(t, restored.UnmarshalSealed(key, sealed[:10]), ErrInvalidSnapshot)
+
+	_, err = r.MarshalSealed(key[:5])
+	assert.NotNil(t, err)
+}
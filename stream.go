@@ -0,0 +1,81 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+import (
+	"crypto/cipher"
+	"unsafe"
+)
+
+// stream adapts a pad set and a selector to crypto/cipher.Stream
+type stream struct {
+	ps      *PadSet
+	sel     Selector
+	decrypt bool
+}
+
+// NewEncryptStream returns a cipher.Stream encrypting with the pads and the selector,
+// e.g. for cipher.StreamWriter. QPP permutes bytes rather than XORing a keystream,
+// so the encrypt and decrypt streams are not interchangeable.
+// It panics for 16-qubit pad sets, whose 2-byte symbols cannot be emitted byte by byte,
+// NewWriter and NewReader hold back split symbols instead.
+func NewEncryptStream(ps *PadSet, sel Selector) cipher.Stream {
+	checkStreamable(ps)
+	return &stream{ps: ps, sel: sel}
+}
+
+// NewDecryptStream returns a cipher.Stream decrypting with the pads and the selector,
+// e.g. for cipher.StreamReader. It panics for 16-qubit pad sets, as NewEncryptStream.
+func NewDecryptStream(ps *PadSet, sel Selector) cipher.Stream {
+	checkStreamable(ps)
+	return &stream{ps: ps, sel: sel, decrypt: true}
+}
+
+// checkStreamable panics if the symbols of ps span more than a byte
+func checkStreamable(ps *PadSet) {
+	if ps.qubits > QUBITS {
+		panic("qpp: cipher.Stream needs pads of at most 8 qubits")
+	}
+}
+
+// XORKeyStream encrypts or decrypts src into dst, which may be the same buffer
+// As with the other cipher.Stream implementations, dst and src must overlap
+// entirely or not at all, and dst must be at least as long as src.
+func (s *stream) XORKeyStream(dst, src []byte) {
+	if len(dst) < len(src) {
+		panic("qpp: output smaller than input")
+	}
+	dst = dst[:len(src)]
+	if inexactOverlap(dst, src) {
+		panic("qpp: invalid buffer overlap")
+	}
+
+	copy(dst, src)
+	if s.decrypt {
+		s.ps.DecryptWithSelector(dst, s.sel)
+	} else {
+		s.ps.EncryptWithSelector(dst, s.sel)
+	}
+}
+
+// inexactOverlap reports whether x and y share memory at different offsets
+func inexactOverlap(x, y []byte) bool {
+	if len(x) == 0 || len(y) == 0 || &x[0] == &y[0] {
+		return false
+	}
+	return uintptr(unsafe.Pointer(&x[0])) <= uintptr(unsafe.Pointer(&y[len(y)-1])) &&
+		uintptr(unsafe.Pointer(&y[0])) <= uintptr(unsafe.Pointer(&x[len(x)-1]))
+}
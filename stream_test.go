@@ -0,0 +1,100 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStream(t *testing.T) {
+	seed := make([]byte, 32)
+	io.ReadFull(rand.Reader, seed)
+	qpp := NewQPP(seed, 977)
+
+	original := make([]byte, 65536)
+	io.ReadFull(rand.Reader, original)
+	expected := append([]byte(nil), original...)
+	qpp.EncryptWithPRNG(expected, CreatePRNG(seed))
+
+	// distinct buffers leave the source untouched
+	src := append([]byte(nil), original...)
+	dst := make([]byte, len(src)+10)
+	enc := NewEncryptStream(qpp.PadSet, CreatePRNG(seed))
+	off := 0
+	encryptChunked(src, 1000, 1, func(b []byte) {
+		enc.XORKeyStream(dst[off:], b)
+		off += len(b)
+	})
+	assert.Equal(t, original, src, "source modified")
+	assert.Equal(t, expected, dst[:len(original)])
+
+	// exact overlap works in place
+	msg := append([]byte(nil), expected...)
+	dec := NewDecryptStream(qpp.PadSet, CreatePRNG(seed))
+	encryptChunked(msg, 999, 1, func(b []byte) { dec.XORKeyStream(b, b) })
+	assert.Equal(t, original, msg, "not equal")
+
+	assert.PanicsWithValue(t, "qpp: invalid buffer overlap", func() { enc.XORKeyStream(msg[1:], msg[:100]) })
+	assert.PanicsWithValue(t, "qpp: output smaller than input", func() { enc.XORKeyStream(msg[:10], msg[10:30]) })
+}
+
+func TestStreamQubits(t *testing.T) {
+	seed := []byte("stream qubits")
+	for _, qubits := range []uint8{4, 8} {
+		ps, err := NewPadSet(seed, &Options{NumPads: 3, Qubits: qubits})
+		assert.Nil(t, err)
+
+		// odd lengths are fine below 16 qubits
+		msg := []byte("odd bytes")
+		original := append([]byte(nil), msg...)
+		NewEncryptStream(ps, ps.CreatePRNG(seed)).XORKeyStream(msg, msg)
+		NewDecryptStream(ps, ps.CreatePRNG(seed)).XORKeyStream(msg, msg)
+		assert.Equal(t, original, msg)
+	}
+
+	ps, err := NewPadSet(seed, &Options{NumPads: 1, Qubits: 16, KDF: HKDF{}})
+	assert.Nil(t, err)
+	rand := ps.CreatePRNG(seed)
+	assert.PanicsWithValue(t, "qpp: cipher.Stream needs pads of at most 8 qubits", func() { NewEncryptStream(ps, rand) })
+	assert.PanicsWithValue(t, "qpp: cipher.Stream needs pads of at most 8 qubits", func() { NewDecryptStream(ps, rand) })
+}
+
+func TestStreamReaderWriter(t *testing.T) {
+	seed := make([]byte, 32)
+	io.ReadFull(rand.Reader, seed)
+	ps, err := NewPadSet(seed, &Options{NumPads: 977})
+	assert.Nil(t, err)
+
+	original := make([]byte, 100000)
+	io.ReadFull(rand.Reader, original)
+
+	var ciphertext bytes.Buffer
+	w := cipher.StreamWriter{S: NewEncryptStream(ps, ps.CreatePRNG(seed)), W: &ciphertext}
+	_, err = io.Copy(w, bytes.NewReader(original))
+	assert.Nil(t, err)
+	assert.NotEqual(t, original, ciphertext.Bytes())
+
+	r := cipher.StreamReader{S: NewDecryptStream(ps, ps.CreatePRNG(seed)), R: &ciphertext}
+	plaintext, err := io.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, original, plaintext, "not equal")
+}
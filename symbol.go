@@ -0,0 +1,116 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// symbolCipher encrypts or decrypts one symbol at a time for the 4- and 16-qubit
+// pads that the byte paths do not handle.
+//
+// The stream follows the same rules as the byte paths: every padSwitch symbols
+// a new 64-bit word r is drawn, which selects the pad of the segment and provides
+// the XOR masks of its symbols. Segments needing more than 64 mask bits take the
+// remaining masks from words derived from r, so the state of the selector stays the
+// pair (r, count) and 8-qubit pads produce the same stream as the byte paths.
+type symbolCipher struct {
+	ps      *PadSet
+	sel     Selector
+	r       uint64 // current random word
+	count   int    // number of symbols consumed in the current segment
+	base    int    // index of the first entry of the selected pad
+	decrypt bool
+}
+
+// cryptSymbols splits data into symbols of ps.qubits bits and runs them through the pads
+// 4-qubit symbols are the low then high nibble of each byte, 16-qubit symbols are
+// little-endian byte pairs, so the data must hold a whole number of symbols.
+func (ps *PadSet) cryptSymbols(data []byte, sel Selector, decrypt bool) {
+	r, count := sel.State()
+	c := symbolCipher{ps: ps, sel: sel, r: r, count: int(count), decrypt: decrypt}
+	c.base = int(ps.padIndex(c.r)) << ps.qubits
+
+	switch ps.qubits {
+	case 4:
+		for i, b := range data {
+			lo := c.crypt(uint16(b & 0xF))
+			hi := c.crypt(uint16(b >> 4))
+			data[i] = byte(hi<<4 | lo)
+		}
+	case 8:
+		for i, b := range data {
+			data[i] = byte(c.crypt(uint16(b)))
+		}
+	case 16:
+		if len(data)%2 != 0 {
+			panic(fmt.Sprintf("qpp: data length %d is not a multiple of the 16-qubit symbol size", len(data)))
+		}
+		for i := 0; i < len(data); i += 2 {
+			v := c.crypt(uint16(data[i]) | uint16(data[i+1])<<8)
+			data[i] = byte(v)
+			data[i+1] = byte(v >> 8)
+		}
+	}
+
+	// set back r & count
+	sel.SetState(c.r, uint8(c.count))
+
+	// the pads may live in locked memory released by the finalizer of ps
+	runtime.KeepAlive(ps)
+}
+
+// crypt permutes a single symbol and advances the stream
+func (c *symbolCipher) crypt(v uint16) uint16 {
+	mask := c.mask()
+	if c.decrypt {
+		v = c.lookup(c.ps.rpads, c.ps.rpads16, v) ^ mask
+	} else {
+		v = c.lookup(c.ps.pads, c.ps.pads16, v^mask)
+	}
+
+	// switch to another pad when count reaches padSwitch
+	c.count++
+	if c.count == c.ps.padSwitch {
+		c.r = c.sel.Uint64()
+		c.base = int(c.ps.padIndex(c.r)) << c.ps.qubits
+		c.count = 0
+	}
+	return v
+}
+
+// mask returns the XOR mask of the current symbol
+func (c *symbolCipher) mask() uint16 {
+	bit := c.count * int(c.ps.qubits)
+	return uint16(segmentWord(c.r, bit/64)>>(bit%64)) & uint16(1<<c.ps.qubits-1)
+}
+
+// segmentWord returns the j-th mask word of the segment drawn as r, the first one is r itself
+func segmentWord(r uint64, j int) uint64 {
+	if j == 0 {
+		return r
+	}
+	return xorshift64star(r + uint64(j)*goldenGamma)
+}
+
+// lookup returns entry v of the selected pad in the byte or 16-bit tables
+func (c *symbolCipher) lookup(table []byte, table16 []uint16, v uint16) uint16 {
+	if table16 != nil {
+		return table16[c.base+int(v)]
+	}
+	return uint16(table[c.base+int(v)])
+}
@@ -0,0 +1,195 @@
+// # Copyright (c) 2024 xtaci
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package qpp
+
+import (
+	"crypto/rand"
+	"io"
+	mathrand "math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// encryptChunked encrypts or decrypts msg in random chunks of up to maxChunk bytes, rounded down to a multiple of align
+func encryptChunked(msg []byte, maxChunk, align int, f func([]byte)) {
+	for len(msg) > 0 {
+		l := min(len(msg), mathrand.Intn(maxChunk+1)/align*align)
+		f(msg[:l])
+		msg = msg[l:]
+	}
+}
+
+func TestSymbolPathMatchesUnrolled(t *testing.T) {
+	seed := make([]byte, 32)
+	io.ReadFull(rand.Reader, seed)
+
+	for _, unbiased := range []bool{false, true} {
+		unrolled, err := NewPadSet(seed, &Options{NumPads: 977, Unbiased: unbiased})
+		assert.Nil(t, err)
+		generic := *unrolled
+		generic.unrolled = false
+
+		original := make([]byte, 65536)
+		io.ReadFull(rand.Reader, original)
+		expected := append([]byte(nil), original...)
+		msg := append([]byte(nil), original...)
+
+		r1, r2 := FastPRNG(seed), FastPRNG(seed)
+		encryptChunked(expected, 29, 1, func(b []byte) { unrolled.EncryptWithPRNG(b, r1) })
+		encryptChunked(msg, 31, 1, func(b []byte) { generic.EncryptWithPRNG(b, r2) })
+		assert.Equal(t, expected, msg, "symbol path disagrees with unrolled path")
+		assert.Equal(t, r1, r2, "PRNG states differ")
+
+		r1, r2 = FastPRNG(seed), FastPRNG(seed)
+		encryptChunked(expected, 13, 1, func(b []byte) { unrolled.DecryptWithPRNG(b, r1) })
+		encryptChunked(msg, 17, 1, func(b []byte) { generic.DecryptWithPRNG(b, r2) })
+		assert.Equal(t, original, expected, "not equal")
+		assert.Equal(t, original, msg, "not equal")
+	}
+}
+
+func testQubits(t *testing.T, qubits uint8, numPads int, kdf KDF) {
+	seed := make([]byte, 32)
+	io.ReadFull(rand.Reader, seed)
+
+	sender, err := New(seed, &Options{NumPads: numPads, Qubits: qubits, KDF: kdf})
+	assert.Nil(t, err)
+	receiver, err := New(seed, &Options{NumPads: numPads, Qubits: qubits, KDF: kdf})
+	assert.Nil(t, err)
+
+	// every pad must be a permutation of the 2^qubits symbols
+	entries := 1 << qubits
+	for i := range numPads {
+		seen := make([]bool, entries)
+		for j := range entries {
+			var v int
+			if qubits == 16 {
+				v = int(sender.pads16[i*entries+j])
+				assert.Equal(t, uint16(j), sender.rpads16[i*entries+v], "not reversible")
+			} else {
+				v = int(sender.pads[i*entries+j])
+				assert.Equal(t, byte(j), sender.rpads[i*entries+v], "not reversible")
+			}
+			assert.Less(t, v, entries, "symbol out of range")
+			assert.False(t, seen[v], "not a permutation")
+			seen[v] = true
+		}
+	}
+
+	align := max(int(qubits)/8, 1)
+	original := make([]byte, 65536)
+	io.ReadFull(rand.Reader, original)
+	msg := append([]byte(nil), original...)
+	encryptChunked(msg, 37, align, sender.Encrypt)
+	assert.NotEqual(t, original, msg, "not encrypted")
+	encryptChunked(msg, 41, align, receiver.Decrypt)
+	assert.Equal(t, original, msg, "not equal")
+}
+
+func TestQubits4(t *testing.T) {
+	testQubits(t, 4, 31, nil)
+}
+
+func TestQubits16(t *testing.T) {
+	// HKDF keeps the expansion of the 3727 seed chunks of 16 qubits fast
+	testQubits(t, 16, 3, HKDF{})
+
+	seed := make([]byte, 32)
+	io.ReadFull(rand.Reader, seed)
+	qpp, err := New(seed, &Options{NumPads: 1, Qubits: 16, KDF: HKDF{}})
+	assert.Nil(t, err)
+	assert.Panics(t, func() { qpp.Encrypt(make([]byte, 3)) }, "odd length accepted")
+}
+
+func TestPadSwitch(t *testing.T) {
+	seed := make([]byte, 32)
+	io.ReadFull(rand.Reader, seed)
+
+	for _, qubits := range []uint8{4, 8, 16} {
+		for _, padSwitch := range []int{1, 2, 3, 4, 8, 16, 32, 255} {
+			ps, err := NewPadSet(seed, &Options{NumPads: 31, Qubits: qubits, PadSwitch: padSwitch, Version: PADS_V2, KDF: HKDF{}})
+			assert.Nil(t, err)
+
+			align := max(int(qubits)/8, 1)
+			symbolsPerByte := 8 / float64(qubits)
+			original := make([]byte, 4096)
+			io.ReadFull(rand.Reader, original)
+
+			// encrypting in one call and in arbitrary chunks must give the same stream
+			expected := append([]byte(nil), original...)
+			whole := FastPRNG(seed)
+			ps.EncryptWithPRNG(expected, whole)
+
+			// the byte paths of 8-qubit pads keep the stream of the symbol path
+			generic := append([]byte(nil), original...)
+			ps.cryptSymbols(generic, FastPRNG(seed), false)
+			assert.Equal(t, expected, generic, "qubits %d, pad switch %d: byte and symbol paths differ", qubits, padSwitch)
+
+			msg := append([]byte(nil), original...)
+			chunked := FastPRNG(seed)
+			encryptChunked(msg, 2*padSwitch+3, align, func(b []byte) {
+				before := int(chunked.count)
+				ps.EncryptWithPRNG(b, chunked)
+				symbols := int(float64(len(b)) * symbolsPerByte)
+				assert.Equal(t, (before+symbols)%padSwitch, int(chunked.count), "count out of sync")
+			})
+			assert.Equal(t, expected, msg, "qubits %d, pad switch %d: chunking changed the ciphertext", qubits, padSwitch)
+			assert.Equal(t, whole, chunked, "qubits %d, pad switch %d: PRNG states differ", qubits, padSwitch)
+
+			decrypter := FastPRNG(seed)
+			encryptChunked(msg, padSwitch+5, align, func(b []byte) { ps.DecryptWithPRNG(b, decrypter) })
+			assert.Equal(t, original, msg, "qubits %d, pad switch %d: not equal", qubits, padSwitch)
+		}
+	}
+}
+
+func BenchmarkPadSwitch1(b *testing.B) {
+	benchmarkPadSwitch(b, 1)
+}
+
+func BenchmarkPadSwitch8(b *testing.B) {
+	benchmarkPadSwitch(b, 8)
+}
+
+func BenchmarkPadSwitch16(b *testing.B) {
+	benchmarkPadSwitch(b, 16)
+}
+
+func BenchmarkPadSwitch64(b *testing.B) {
+	benchmarkPadSwitch(b, 64)
+}
+
+func BenchmarkPadSwitch255(b *testing.B) {
+	benchmarkPadSwitch(b, 255)
+}
+
+func benchmarkPadSwitch(b *testing.B, padSwitch int) {
+	seed := make([]byte, 32)
+	io.ReadFull(rand.Reader, seed)
+	qpp, err := New(seed, &Options{NumPads: 61, PadSwitch: padSwitch, Version: PADS_V2})
+	if err != nil {
+		b.Fatal(err)
+	}
+	msg := make([]byte, 512)
+	io.ReadFull(rand.Reader, msg)
+
+	b.ResetTimer()
+	b.SetBytes(int64(len(msg)))
+	for i := 0; i < b.N; i++ {
+		qpp.Encrypt(msg)
+	}
+}